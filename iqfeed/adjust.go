@@ -0,0 +1,151 @@
+package iqfeed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdjustSplits adjusts prices and volumes for splits, dividends are not supported since the IQFeed fundamentals
+// only have the most recent dividend, which would leave the bars before earlier dividends unadjusted
+const AdjustSplits = "splits"
+
+// corporateAction is a split, the prices of the bars before the date are multiplied by the price factor and the
+// volumes divided by the volume factor
+type corporateAction struct {
+	date         string
+	priceFactor  float64
+	volumeFactor float64
+}
+
+// adjustment back-adjusts bars for the corporate actions of a symbol
+type adjustment struct {
+	actions []corporateAction
+}
+
+// ValidateAdjust checks that adjusted prices are requested for daily bars of new files
+func ValidateAdjust(config *Config) error {
+	config.Adjust = strings.ToLower(config.Adjust)
+
+	switch config.Adjust {
+	case "":
+		if config.AdjustFactor {
+			return fmt.Errorf("the adjustment factor column requires adjusted prices")
+		}
+
+		return nil
+	case AdjustSplits:
+	case "dividends", "all":
+		return fmt.Errorf("dividend adjustment is not supported, IQFeed only has the most recent dividend of a symbol")
+	default:
+		return fmt.Errorf("unsupported adjustment: %s", config.Adjust)
+	}
+
+	if strings.ToLower(config.Command) != "eod" {
+		return fmt.Errorf("adjusted prices are only supported for eod downloads")
+	}
+
+	// Appending to a file adjusted before a later split would mix adjustments
+	if config.Update {
+		return fmt.Errorf("adjusted prices can not be updated, download them again instead")
+	}
+
+	if config.ReplayDirectory != "" {
+		return fmt.Errorf("adjusted prices can not be replayed")
+	}
+
+	return nil
+}
+
+// loadAdjustment requests the splits of the symbol from its fundamental data
+func loadAdjustment(ctx context.Context, symbol string, config *Config) (adjustment, error) {
+	found, err := requestFundamentals(ctx, []string{symbol}, config)
+
+	if err != nil {
+		return adjustment{}, fmt.Errorf("could not request fundamentals: %w", err)
+	}
+
+	data, exists := found[strings.ToUpper(symbol)]
+
+	if !exists {
+		return adjustment{}, nil
+	}
+
+	var actions []corporateAction
+
+	for _, split := range [][2]string{{data.split1, data.split1Date}, {data.split2, data.split2Date}} {
+		factor, err := strconv.ParseFloat(split[0], 64)
+
+		if err == nil && factor > 0 && split[1] != "" {
+			actions = append(actions, corporateAction{date: split[1], priceFactor: factor, volumeFactor: factor})
+		}
+	}
+
+	return adjustment{actions: actions}, nil
+}
+
+// factors returns the price and volume factors of a bar, the product of the factors of later actions
+func (a adjustment) factors(date string) (priceFactor float64, volumeFactor float64) {
+	priceFactor = 1
+	volumeFactor = 1
+
+	for _, action := range a.actions {
+		if date < action.date {
+			priceFactor *= action.priceFactor
+			volumeFactor *= action.volumeFactor
+		}
+	}
+
+	return priceFactor, volumeFactor
+}
+
+// mapEodBar maps a daily bar with back-adjusted prices and volume, and the adjustment factor when configured
+func (a adjustment) mapEodBar(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error) {
+	bar, err := parseDailyBar(iqfeedRow, tz)
+
+	if err != nil {
+		return "", err
+	}
+
+	date := bar.Time.Format(dateFormat)
+	priceFactor, volumeFactor := a.factors(date)
+
+	// Unadjusted prices are written as received, adjusted prices keep the decimals of IQFeed and at least 4
+	price := func(raw string, value float64) string {
+		if priceFactor == 1 {
+			return raw
+		}
+
+		decimals := 0
+
+		if separator := strings.Index(raw, "."); separator >= 0 {
+			decimals = len(raw) - separator - 1
+		}
+
+		if decimals < 4 {
+			decimals = 4
+		}
+
+		return strconv.FormatFloat(value*priceFactor, 'f', decimals, 64)
+	}
+
+	// Columns from IQFeed: timestamp, high, low, open, close, volume, openInterest
+	columns := []string{
+		formatTimestamp(bar.Time, dateFormat, config),
+		price(iqfeedRow[4], bar.Open),
+		price(iqfeedRow[2], bar.High),
+		price(iqfeedRow[3], bar.Low),
+		price(iqfeedRow[5], bar.Close),
+		strconv.FormatInt(int64(math.Round(float64(bar.Volume)/volumeFactor)), 10),
+		strconv.FormatInt(bar.OpenInterest, 10),
+	}
+
+	if config.AdjustFactor {
+		columns = append(columns, strconv.FormatFloat(priceFactor, 'f', -1, 64))
+	}
+
+	return strings.Join(columns, csvSeparator), nil
+}
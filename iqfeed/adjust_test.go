@@ -0,0 +1,198 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAdjust(t *testing.T) {
+	t.Run("eod", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+		config.Adjust = "SPLITS"
+
+		err := ValidateAdjust(config)
+
+		assert.Equal(t, AdjustSplits, config.Adjust)
+		assert.Nil(t, err)
+	})
+
+	t.Run("dividends", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+		config.Adjust = "all"
+
+		assert.NotNil(t, ValidateAdjust(config))
+	})
+
+	t.Run("unsupported adjustment", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+		config.Adjust = "earnings"
+
+		assert.NotNil(t, ValidateAdjust(config))
+	})
+
+	t.Run("minute bars", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "minute"
+		config.Adjust = AdjustSplits
+
+		assert.NotNil(t, ValidateAdjust(config))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+		config.Adjust = AdjustSplits
+		config.Update = true
+
+		assert.NotNil(t, ValidateAdjust(config))
+	})
+
+	t.Run("factor column without adjustment", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.AdjustFactor = true
+
+		assert.NotNil(t, ValidateAdjust(config))
+	})
+}
+
+func TestAdjustmentMapEodBar(t *testing.T) {
+	adjusted := adjustment{actions: []corporateAction{
+		{date: "2019-02-22", priceFactor: 0.5, volumeFactor: 0.5},
+		{date: "2019-03-01", priceFactor: 0.99, volumeFactor: 1},
+	}}
+
+	t.Run("before all actions", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.AdjustFactor = true
+
+		row, err := adjusted.mapEodBar(strings.Split(testValidIqfeedEodBar, ","), et, config)
+
+		assert.Equal(t, "2019-02-21,11.8156,11.9097,11.7829,11.8800,58366,0,0.495", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("on the date of an action", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedEodBar, ",")
+		columns[1] = "2019-02-22"
+
+		row, err := adjusted.mapEodBar(columns, et, createConfig(0, "", false, false))
+
+		assert.Equal(t, "2019-02-22,23.6313,23.8194,23.5658,23.7600,29183,0", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("after all actions", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedEodBar, ",")
+		columns[1] = "2019-03-01"
+		columns[2] = "24.06"
+
+		row, err := adjusted.mapEodBar(columns, et, createConfig(0, "", false, false))
+
+		assert.Equal(t, "2019-03-01,23.8700,24.06,23.8038,24.0000,29183,0", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("sub-penny prices", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedEodBar, ",")
+		columns[2] = "0.123456"
+
+		row, err := adjusted.mapEodBar(columns, et, createConfig(0, "", false, false))
+
+		assert.Equal(t, "2019-02-21,11.8156,0.061111,11.7829,11.8800,58366,0", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		_, err := adjusted.mapEodBar(strings.Split(testTooFewColumnsIqfeedEodBar, ","), et, createConfig(0, "", false, false))
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+}
+
+// startSplitServer serves the fundamentals of SPY with a 1:2 split on the Level 1 port, after closing the first
+// connections without a reply
+func startSplitServer(t *testing.T, closedConnections int) int {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for connections := 0; ; connections++ {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			if connections < closedConnections {
+				_ = conn.Close()
+				continue
+			}
+
+			scanner := bufio.NewScanner(conn)
+
+			for scanner.Scan() {
+				if strings.HasPrefix(scanner.Text(), "wSPY") {
+					fundamentals := strings.Split(testFundamentals, ",")
+					fundamentals[1] = "SPY"
+					fundamentals[35] = "0.50 02/22/2019"
+					fundamentals[36] = ""
+					_, _ = fmt.Fprintf(conn, "%s\r\nP,SPY,24.0500,\r\n", strings.Join(fundamentals, ","))
+				}
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestAdjustedEodIntegration(t *testing.T) {
+	adjustedFile := "date,open,high,low,close,volume,oi,adj_factor\n" +
+		"2019-02-21,11.9350,12.0300,11.9019,12.0000,58366,0,0.5\n" +
+		"2019-02-22,23.9500,24.1000,23.9000,24.0500,31022,0,1\n"
+
+	t.Run("split", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+		}))
+		config.Command = "eod"
+		config.Adjust = AdjustSplits
+		config.AdjustFactor = true
+		config.Level1Port = startSplitServer(t, 0)
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, 1, len(server.Requests()))
+		assert.Equal(t, adjustedFile, readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+	})
+
+	t.Run("retry closed fundamentals connection", func(t *testing.T) {
+		_, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+		}))
+		config.Command = "eod"
+		config.Adjust = AdjustSplits
+		config.AdjustFactor = true
+		config.Level1Port = startSplitServer(t, 1)
+		config.Retries = 1
+		config.RetryDelay = 0
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, DownloadEod)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, adjustedFile, readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+	})
+}
@@ -0,0 +1,222 @@
+package iqfeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ChunkDay   = "day"
+	ChunkWeek  = "week"
+	ChunkMonth = "month"
+)
+
+// chunk is the date range of one sub-request of a download, in request time format
+type chunk struct {
+	start string
+	end   string
+}
+
+// checkpoint records the completed chunks written to the temporary file of a download,
+// so a retry can truncate the file to the checkpoint and resume with the next chunk
+type checkpoint struct {
+	Chunk     string `json:"chunk"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Completed string `json:"completed"`
+	Rows      int    `json:"rows"`
+	Bytes     int64  `json:"bytes"`
+	Size      int64  `json:"size"`
+}
+
+// ValidateChunk checks the chunk size and that the command supports date range chunks
+func ValidateChunk(config *Config) error {
+	config.Chunk = strings.ToLower(config.Chunk)
+
+	switch config.Chunk {
+	case "":
+		return nil
+	case ChunkDay, ChunkWeek, ChunkMonth:
+	default:
+		return fmt.Errorf("unsupported chunk size: %s", config.Chunk)
+	}
+
+	switch strings.ToLower(config.Command) {
+	case "eod", "weekly", "monthly":
+		return fmt.Errorf("chunks are only supported for minute, tick and interval downloads")
+	}
+
+	if config.StartDate == "" {
+		return fmt.Errorf("chunks require a start date")
+	}
+
+	// Parquet files are written with a footer at the end and can not be resumed from a checkpoint
+	if strings.ToLower(config.Format) == ParquetFormat {
+		return fmt.Errorf("chunks are not supported for parquet files")
+	}
+
+	return nil
+}
+
+// planChunks splits the date range of the config into consecutive chunks,
+// a config without chunk size gives a single chunk with the unchanged date range
+func planChunks(config *Config, now time.Time) ([]chunk, error) {
+	if config.Chunk == "" {
+		return []chunk{{start: config.StartDate, end: config.EndDate}}, nil
+	}
+
+	start, err := parseRequestTime(config.StartDate, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	end := now.In(sourceLocation).Truncate(time.Second)
+
+	if config.EndDate != "" {
+		end, err = parseRequestTime(config.EndDate, true)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var chunks []chunk
+
+	for !start.After(end) {
+		next := nextChunkStart(start, config.Chunk)
+		chunkEnd := next.Add(-time.Second)
+
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		chunks = append(chunks, chunk{start: start.Format(requestTimeFormat), end: chunkEnd.Format(requestTimeFormat)})
+		start = next
+	}
+
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("start date %s is after end date %s", config.StartDate, config.EndDate)
+	}
+
+	return chunks, nil
+}
+
+// parseRequestTime parses a request date or time in the IQFeed time zone,
+// a date without time is the start of the day or the last second of the day for end dates
+func parseRequestTime(value string, endOfDay bool) (time.Time, error) {
+	if len(value) != len(requestDateFormat) {
+		timestamp, err := time.ParseInLocation(requestTimeFormat, value, sourceLocation)
+
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not parse request time: %s", err)
+		}
+
+		return timestamp, nil
+	}
+
+	date, err := time.ParseInLocation(requestDateFormat, value, sourceLocation)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse request date: %s", err)
+	}
+
+	if endOfDay {
+		date = date.AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	return date, nil
+}
+
+// nextChunkStart returns the start of the day, week (Monday) or month following the timestamp
+func nextChunkStart(timestamp time.Time, size string) time.Time {
+	year, month, day := timestamp.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, timestamp.Location())
+
+	switch size {
+	case ChunkWeek:
+		days := (8 - int(midnight.Weekday())) % 7
+
+		if days == 0 {
+			days = 7
+		}
+
+		return midnight.AddDate(0, 0, days)
+	case ChunkMonth:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, timestamp.Location())
+	default:
+		return midnight.AddDate(0, 0, 1)
+	}
+}
+
+func newCheckpoint(config *Config) checkpoint {
+	return checkpoint{Chunk: config.Chunk, StartDate: config.StartDate, EndDate: config.EndDate}
+}
+
+// readCheckpoint returns the checkpoint of a previous attempt with the same chunks, if any
+func readCheckpoint(path string, config *Config) (checkpoint, bool) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return checkpoint{}, false
+	}
+
+	var saved checkpoint
+	err = json.Unmarshal(data, &saved)
+	expected := newCheckpoint(config)
+
+	if err != nil || saved.Chunk != expected.Chunk || saved.StartDate != expected.StartDate || saved.EndDate != expected.EndDate {
+		return checkpoint{}, false
+	}
+
+	return saved, true
+}
+
+// saveCheckpoint syncs the temporary file and records its size with the completed chunks
+func saveCheckpoint(path string, file *os.File, progress checkpoint) error {
+	err := file.Sync()
+
+	if err != nil {
+		return err
+	}
+
+	progress.Size, err = file.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(progress)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// openCheckpointFile opens the temporary file of a previous attempt truncated to the checkpoint size
+func openCheckpointFile(path string, size int64) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = file.Truncate(size)
+
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,143 @@
+package iqfeed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanChunks(t *testing.T) {
+	now := time.Date(2019, 3, 6, 12, 30, 0, 0, et)
+
+	t.Run("no chunks", func(t *testing.T) {
+		config := &Config{StartDate: "20190101", EndDate: "20190301"}
+
+		chunks, err := planChunks(config, now)
+
+		assert.Equal(t, []chunk{{start: "20190101", end: "20190301"}}, chunks)
+		assert.Nil(t, err)
+	})
+
+	t.Run("day chunks", func(t *testing.T) {
+		config := &Config{StartDate: "20190226", EndDate: "20190227", Chunk: ChunkDay}
+
+		chunks, err := planChunks(config, now)
+
+		assert.Equal(t, []chunk{
+			{start: "20190226 000000", end: "20190226 235959"},
+			{start: "20190227 000000", end: "20190227 235959"},
+		}, chunks)
+		assert.Nil(t, err)
+	})
+
+	t.Run("week chunks start on monday", func(t *testing.T) {
+		config := &Config{StartDate: "20190221", EndDate: "20190305", Chunk: ChunkWeek}
+
+		chunks, err := planChunks(config, now)
+
+		assert.Equal(t, []chunk{
+			{start: "20190221 000000", end: "20190224 235959"},
+			{start: "20190225 000000", end: "20190303 235959"},
+			{start: "20190304 000000", end: "20190305 235959"},
+		}, chunks)
+		assert.Nil(t, err)
+	})
+
+	t.Run("month chunks until now", func(t *testing.T) {
+		config := &Config{StartDate: "20190115 093000", Chunk: ChunkMonth}
+
+		chunks, err := planChunks(config, now)
+
+		assert.Equal(t, []chunk{
+			{start: "20190115 093000", end: "20190131 235959"},
+			{start: "20190201 000000", end: "20190228 235959"},
+			{start: "20190301 000000", end: "20190306 123000"},
+		}, chunks)
+		assert.Nil(t, err)
+	})
+
+	t.Run("start after end", func(t *testing.T) {
+		config := &Config{StartDate: "20190301", EndDate: "20190201", Chunk: ChunkMonth}
+
+		_, err := planChunks(config, now)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestValidateChunk(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		config := &Config{Command: "tick", StartDate: "20190101", Chunk: "Week"}
+
+		err := ValidateChunk(config)
+
+		assert.Equal(t, ChunkWeek, config.Chunk)
+		assert.Nil(t, err)
+	})
+
+	t.Run("unsupported chunk size", func(t *testing.T) {
+		err := ValidateChunk(&Config{Command: "tick", StartDate: "20190101", Chunk: "year"})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unsupported command", func(t *testing.T) {
+		err := ValidateChunk(&Config{Command: "eod", StartDate: "20190101", Chunk: ChunkDay})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("missing start date", func(t *testing.T) {
+		err := ValidateChunk(&Config{Command: "minute", Chunk: ChunkDay})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("parquet format", func(t *testing.T) {
+		err := ValidateChunk(&Config{Command: "tick", StartDate: "20190101", Chunk: ChunkDay, Format: ParquetFormat})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Run("resume from saved checkpoint", func(t *testing.T) {
+		directory := t.TempDir()
+		tmpPath := filepath.Join(directory, "SPY.csv.tmp")
+		checkpointPath := filepath.Join(directory, "SPY.csv.chunk")
+		config := &Config{StartDate: "20190101", EndDate: "20190301", Chunk: ChunkMonth}
+		file, _ := os.Create(tmpPath)
+		_, _ = file.WriteString("datetime,open,high,low,close,volume\n2019-01-31 15:59:00,1,1,1,1,1\n")
+		progress := newCheckpoint(config)
+		progress.Completed = "20190131 235959"
+		progress.Rows = 1
+
+		err := saveCheckpoint(checkpointPath, file, progress)
+		_, _ = file.WriteString("2019-02-01 09:30:00,2,2,2,2,2\n")
+		_ = file.Close()
+		saved, ok := readCheckpoint(checkpointPath, config)
+		resumed, _ := openCheckpointFile(tmpPath, saved.Size)
+		_ = resumed.Close()
+		content, _ := os.ReadFile(tmpPath)
+
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "20190131 235959", saved.Completed)
+		assert.Equal(t, 1, saved.Rows)
+		assert.Equal(t, "datetime,open,high,low,close,volume\n2019-01-31 15:59:00,1,1,1,1,1\n", string(content))
+	})
+
+	t.Run("ignore checkpoint of other date range", func(t *testing.T) {
+		checkpointPath := filepath.Join(t.TempDir(), "SPY.csv.chunk")
+		file, _ := os.Create(filepath.Join(t.TempDir(), "SPY.csv.tmp"))
+		defer file.Close()
+		_ = saveCheckpoint(checkpointPath, file, newCheckpoint(&Config{StartDate: "20190101", Chunk: ChunkDay}))
+
+		_, ok := readCheckpoint(checkpointPath, &Config{StartDate: "20180101", Chunk: ChunkDay})
+
+		assert.False(t, ok)
+	})
+}
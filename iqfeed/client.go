@@ -0,0 +1,157 @@
+package iqfeed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type IntervalType string
+
+const (
+	IntervalSeconds IntervalType = "S"
+	IntervalVolume  IntervalType = "V"
+	IntervalTicks   IntervalType = "T"
+)
+
+// Client requests typed historical data from IQFeed. Every request uses its own connection,
+// which is closed when the returned iterator is closed or reaches the end of the data.
+// A Client is safe for concurrent use.
+type Client struct {
+	// Location is the time zone of the returned timestamps, US Eastern Time (the IQFeed time zone) when nil
+	Location *time.Location
+
+	// Host and LookupPort are the address of the IQFeed historical lookup port, 127.0.0.1:9100 when empty
+	Host       string
+	LookupPort int
+}
+
+// NewClient creates a client returning timestamps in the given time zone, see LoadLocation
+func NewClient(timeZone string) (*Client, error) {
+	location, err := LoadLocation(timeZone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{Location: location}, nil
+}
+
+// EOD requests daily bars between two dates, a zero from or to date leaves that end of the range open
+func (c *Client) EOD(ctx context.Context, symbol string, from, to time.Time) (*BarIterator, error) {
+	config := c.config(from, to, requestDateFormat)
+	return c.bars(ctx, symbol, createEodRequest, parseDailyBar, config)
+}
+
+// Weekly requests weekly bars between two dates, a zero from or to date leaves that end of the range open
+func (c *Client) Weekly(ctx context.Context, symbol string, from, to time.Time) (*BarIterator, error) {
+	config := c.config(from, to, requestDateFormat)
+	return c.bars(ctx, symbol, createWeeklyRequest, periodBarParser(from, to), config)
+}
+
+// Monthly requests monthly bars between two dates, a zero from or to date leaves that end of the range open
+func (c *Client) Monthly(ctx context.Context, symbol string, from, to time.Time) (*BarIterator, error) {
+	config := c.config(from, to, requestDateFormat)
+	return c.bars(ctx, symbol, createMonthlyRequest, periodBarParser(from, to), config)
+}
+
+// Interval requests interval bars timestamped at the start of the bar, for example 60 IntervalSeconds for minute bars.
+// A zero from or to time leaves that end of the range open.
+func (c *Client) Interval(ctx context.Context, symbol string, length int, intervalType IntervalType, from, to time.Time) (*BarIterator, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("incorrect interval length: %d", length)
+	}
+
+	config := c.config(from, to, requestTimeFormat)
+	config.IntervalLength = length
+	config.IntervalType = string(intervalType)
+	config.UseLabels = true
+
+	return c.bars(ctx, symbol, createIntervalRequest, parseIntervalBar, config)
+}
+
+// Ticks requests ticks, a zero from or to time leaves that end of the range open
+func (c *Client) Ticks(ctx context.Context, symbol string, from, to time.Time) (*TickIterator, error) {
+	config := c.config(from, to, requestTimeFormat)
+	rows, err := c.request(ctx, symbol, createTickRequest, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TickIterator{rows: rows}, nil
+}
+
+func (c *Client) bars(ctx context.Context, symbol string, createRequest requestFactory, parse barParser, config *Config) (*BarIterator, error) {
+	rows, err := c.request(ctx, symbol, createRequest, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &BarIterator{rows: rows, parse: parse}, nil
+}
+
+func (c *Client) request(ctx context.Context, symbol string, createRequest requestFactory, config *Config) (*rowIterator, error) {
+	connection := &Conn{}
+	err := connection.connect(ctx, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	requestId := fmt.Sprintf("%d", atomic.AddInt64(&previousRequestId, 1))
+	err = connection.send(requestId, createRequest(symbol, requestId, config))
+
+	if err != nil {
+		_ = connection.Close()
+		return nil, err
+	}
+
+	return newRowIterator(ctx, connection, requestId, c.location()), nil
+}
+
+func (c *Client) config(from, to time.Time, layout string) *Config {
+	config := &Config{Protocol: NewProtocol, EndTimestamp: false, Host: c.Host, LookupPort: c.LookupPort}
+
+	// Dates are used as given while intraday times are converted to the IQFeed time zone
+	if layout == requestTimeFormat {
+		from = from.In(sourceLocation)
+		to = to.In(sourceLocation)
+	}
+
+	if !from.IsZero() {
+		config.StartDate = from.Format(layout)
+	}
+
+	if !to.IsZero() {
+		config.EndDate = to.Format(layout)
+	}
+
+	return config
+}
+
+func (c *Client) location() *time.Location {
+	if c.Location == nil {
+		return sourceLocation
+	}
+
+	return c.Location
+}
+
+// ParseIntervalType parses seconds, volume or ticks, or any abbreviation of them
+func ParseIntervalType(value string) (IntervalType, error) {
+	upperValue := strings.ToUpper(value)
+
+	if strings.HasPrefix(upperValue, "S") {
+		return IntervalSeconds, nil
+	} else if strings.HasPrefix(upperValue, "V") {
+		return IntervalVolume, nil
+	} else if strings.HasPrefix(upperValue, "T") {
+		return IntervalTicks, nil
+	}
+
+	return "", fmt.Errorf("incorrect interval type: %s", value)
+}
@@ -0,0 +1,132 @@
+package iqfeed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"4d63.com/tz"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDailyBar(t *testing.T) {
+	t.Run("valid eod bar", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedEodBar, ",")
+
+		bar, err := parseDailyBar(columns, et)
+
+		assert.Equal(t, Bar{Time: time.Date(2019, 2, 21, 0, 0, 0, 0, et), Open: 23.87, High: 24.06, Low: 23.8038, Close: 24, Volume: 29183}, bar)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		columns := strings.Split(testTooFewColumnsIqfeedEodBar, ",")
+
+		_, err := parseDailyBar(columns, et)
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+
+	t.Run("invalid price", func(t *testing.T) {
+		columns := strings.Split(strings.Replace(testValidIqfeedEodBar, "24.0600", "x", 1), ",")
+
+		_, err := parseDailyBar(columns, et)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPeriodBarParser(t *testing.T) {
+	t.Run("bar inside date range", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedWeeklyBar, ",")
+
+		bar, err := periodBarParser(time.Date(2019, 2, 1, 0, 0, 0, 0, et), time.Time{})(columns, et)
+
+		assert.Equal(t, time.Date(2019, 2, 15, 0, 0, 0, 0, et), bar.Time)
+		assert.Nil(t, err)
+	})
+
+	t.Run("bar before date range", func(t *testing.T) {
+		columns := strings.Split(testEarlyIqfeedWeeklyBar, ",")
+
+		_, err := periodBarParser(time.Date(2019, 2, 1, 0, 0, 0, 0, et), time.Time{})(columns, et)
+
+		assert.Equal(t, errOutsideRange, err)
+	})
+}
+
+func TestParseIntervalBar(t *testing.T) {
+	t.Run("valid interval bar in cst time zone", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedMinuteBar, ",")
+		cst, _ := tz.LoadLocation("America/Chicago")
+
+		bar, err := parseIntervalBar(columns, cst)
+
+		assert.True(t, time.Date(2019, 2, 26, 11, 22, 0, 0, cst).Equal(bar.Time))
+		assert.Equal(t, cst, bar.Time.Location())
+		assert.Equal(t, 23.8, bar.Close)
+		assert.Equal(t, int64(100), bar.Volume)
+		assert.Nil(t, err)
+	})
+}
+
+func TestParseTick(t *testing.T) {
+	t.Run("valid tick", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedTick, ",")
+
+		tick, err := parseTick(columns, et)
+
+		assert.Equal(t, Tick{
+			Time:        time.Date(2019, 2, 25, 11, 30, 6, 691000000, et),
+			Last:        23.88,
+			LastSize:    12,
+			TotalVolume: 6714,
+			Bid:         23.87,
+			Ask:         23.97,
+			TickId:      6,
+			Basis:       "O",
+			Market:      25,
+			Conditions:  "3D87",
+		}, tick)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		columns := strings.Split(testTooFewColumnsIqfeedTick, ",")
+
+		_, err := parseTick(columns, et)
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+}
+
+func TestClientConfig(t *testing.T) {
+	t.Run("dates are not converted", func(t *testing.T) {
+		config := (&Client{}).config(time.Date(2019, 1, 22, 0, 0, 0, 0, time.UTC), time.Time{}, requestDateFormat)
+
+		assert.Equal(t, "20190122", config.StartDate)
+		assert.Equal(t, "", config.EndDate)
+	})
+
+	t.Run("times are converted to eastern time", func(t *testing.T) {
+		config := (&Client{}).config(time.Date(2019, 1, 22, 15, 0, 0, 0, time.UTC), time.Date(2019, 1, 23, 15, 0, 0, 0, time.UTC), requestTimeFormat)
+
+		assert.Equal(t, "20190122 100000", config.StartDate)
+		assert.Equal(t, "20190123 100000", config.EndDate)
+	})
+}
+
+func TestParseIntervalType(t *testing.T) {
+	t.Run("volume", func(t *testing.T) {
+		intervalType, err := ParseIntervalType("volume")
+
+		assert.Equal(t, IntervalVolume, intervalType)
+		assert.Nil(t, err)
+	})
+
+	t.Run("incorrect type", func(t *testing.T) {
+		_, err := ParseIntervalType("minutes")
+
+		assert.Errorf(t, err, "incorrect interval type: minutes")
+	})
+}
@@ -0,0 +1,189 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultHost           = "127.0.0.1"
+	DefaultLookupPort     = 9100
+	DefaultLevel1Port     = 5009
+	DefaultLevel2Port     = 9200
+	DefaultDerivativePort = 9400
+	drainTimeout          = 30 * time.Second
+)
+
+// Conn is a persistent connection to the IQFeed historical lookup port, reused for consecutive requests.
+// The zero value is ready to use: it connects on the first request and reconnects after failures.
+// A Conn is not safe for concurrent use.
+type Conn struct {
+	conn     net.Conn
+	reader   *csv.Reader
+	recorder *recorder
+	replay   *replay
+	// requested is the protocol sent in the S,SET PROTOCOL message
+	requested string
+	// protocol is the protocol confirmed by the S,CURRENT PROTOCOL message of IQFeed
+	protocol string
+}
+
+// connect dials the IQFeed lookup port and sets the protocol unless the connection is already open
+func (c *Conn) connect(ctx context.Context, config *Config) error {
+	if c.conn != nil {
+		return nil
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", lookupAddress(config))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(&recordingWriter{conn: conn, owner: c}, "S,SET PROTOCOL,%s\r\n", config.Protocol)
+
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("could not set protocol: %s", err)
+	}
+
+	c.open(conn)
+	c.requested = config.Protocol
+	return nil
+}
+
+func (c *Conn) open(conn net.Conn) {
+	c.conn = conn
+	c.reader = csv.NewReader(bufio.NewReaderSize(&recordingReader{conn: conn, owner: c}, bufferSize))
+	c.reader.FieldsPerRecord = -1
+}
+
+// level1Address returns the address of the IQFeed Level 1 port, 127.0.0.1:5009 by default
+func level1Address(config *Config) string {
+	return address(config.Host, config.Level1Port, DefaultLevel1Port)
+}
+
+// lookupAddress returns the address of the IQFeed historical lookup port, 127.0.0.1:9100 by default
+func lookupAddress(config *Config) string {
+	return address(config.Host, config.LookupPort, DefaultLookupPort)
+}
+
+func address(host string, port int, defaultPort int) string {
+	if host == "" {
+		host = DefaultHost
+	}
+
+	if port == 0 {
+		port = defaultPort
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (c *Conn) send(requestId string, request string) error {
+	if c.replay != nil {
+		c.replay.requestId = requestId
+	}
+
+	_, err := fmt.Fprintf(&recordingWriter{conn: c.conn, owner: c}, "%s\r\n", request)
+	return err
+}
+
+// read reads the next row, replayed rows get the id of the current request
+func (c *Conn) read() ([]string, error) {
+	iqfeedRow, err := c.reader.Read()
+
+	if err == nil && c.replay != nil && len(iqfeedRow) > 0 && iqfeedRow[0] != stateMessage {
+		iqfeedRow[0] = c.replay.requestId
+	}
+
+	if err == nil && len(iqfeedRow) >= 3 && iqfeedRow[0] == stateMessage && iqfeedRow[1] == "CURRENT PROTOCOL" {
+		c.protocol = iqfeedRow[2]
+	}
+
+	return iqfeedRow, err
+}
+
+// drain reads and discards the remaining rows of a request up to its end message
+func (c *Conn) drain(requestId string) error {
+	err := c.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		iqfeedRow, err := c.read()
+
+		if err != nil {
+			return err
+		}
+
+		if len(iqfeedRow) >= 2 && iqfeedRow[0] == requestId && iqfeedRow[1] == endMessage {
+			return c.conn.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// watch closes the socket when the context is done to abort blocking reads, until the returned function is called
+func (c *Conn) watch(ctx context.Context) (stop func()) {
+	return watchConn(ctx, c.conn)
+}
+
+func watchConn(ctx context.Context, conn net.Conn) (stop func()) {
+	stopped := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stopped:
+		}
+	}()
+
+	return func() {
+		close(stopped)
+	}
+}
+
+// protocolConfig returns the config with the protocol confirmed by IQFeed, or the config itself before the
+// confirmation or when IQFeed uses the requested protocol
+func (c *Conn) protocolConfig(config *Config) *Config {
+	if c.protocol == "" || c.protocol == config.Protocol {
+		return config
+	}
+
+	confirmed := *config
+	confirmed.Protocol = c.protocol
+	return &confirmed
+}
+
+// protocolAtLeast returns true when the protocol version is the minimum version or later
+func protocolAtLeast(protocol string, minimum string) bool {
+	version, err := strconv.ParseFloat(protocol, 64)
+	required, _ := strconv.ParseFloat(minimum, 64)
+
+	return err == nil && version >= required
+}
+
+// Close closes the connection, the next request opens a new connection
+func (c *Conn) Close() error {
+	var err error
+
+	if c.conn != nil {
+		err = c.conn.Close()
+	}
+
+	c.conn = nil
+	c.reader = nil
+	c.requested = ""
+	c.protocol = ""
+
+	return err
+}
@@ -0,0 +1,43 @@
+package iqfeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupAddress(t *testing.T) {
+	t.Run("default address", func(t *testing.T) {
+		assert.Equal(t, "127.0.0.1:9100", lookupAddress(&Config{}))
+	})
+
+	t.Run("host and port", func(t *testing.T) {
+		assert.Equal(t, "iqfeed:9101", lookupAddress(&Config{Host: "iqfeed", LookupPort: 9101}))
+	})
+
+	t.Run("ipv6 host", func(t *testing.T) {
+		assert.Equal(t, "[::1]:9100", lookupAddress(&Config{Host: "::1"}))
+	})
+}
+
+func TestProtocolConfig(t *testing.T) {
+	t.Run("before confirmation", func(t *testing.T) {
+		config := &Config{Protocol: MicrosecondProtocol}
+
+		assert.Same(t, config, (&Conn{}).protocolConfig(config))
+	})
+
+	t.Run("older confirmed protocol", func(t *testing.T) {
+		config := &Config{Protocol: MicrosecondProtocol}
+
+		confirmed := (&Conn{protocol: DefaultProtocol}).protocolConfig(config)
+
+		assert.Equal(t, DefaultProtocol, confirmed.Protocol)
+		assert.Equal(t, MicrosecondProtocol, config.Protocol)
+		assert.False(t, protocolAtLeast(confirmed.Protocol, MicrosecondProtocol))
+	})
+
+	t.Run("newer confirmed protocol", func(t *testing.T) {
+		assert.True(t, protocolAtLeast("6.2", MicrosecondProtocol))
+	})
+}
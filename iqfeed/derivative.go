@@ -0,0 +1,223 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	historyBarMessage  = "BH"
+	completeBarMessage = "BC"
+	updateBarMessage   = "BU"
+)
+
+// StreamBars watches live interval bars of the symbols on the derivative port. The bars are backfilled from
+// the last bar of existing files, or the start date, and completed bars are appended until the context is done.
+// The files have the same layout as DownloadInterval, a lost connection is backfilled from the last written bar.
+func StreamBars(ctx context.Context, symbols []string, config *Config) error {
+	if config.EndTimestamp && IntervalType(config.IntervalType) != IntervalSeconds {
+		return fmt.Errorf("end of bar timestamps are only supported for seconds bars")
+	}
+
+	location, err := LoadLocation(config.TimeZone)
+
+	if err != nil {
+		return fmt.Errorf("could not load target time zone: %s", err)
+	}
+
+	// Continue existing files after their last bar
+	names := map[string]string{}
+	lastTimestamps := map[string]time.Time{}
+
+	for _, symbol := range symbols {
+		names[strings.ToUpper(symbol)] = symbol
+		path := filepath.Join(config.OutDirectory, getFilename(symbol, config))
+
+		if fileExists(path) {
+			lastTimestamp, err := readLastTimestamp(path, location, config)
+
+			if err != nil {
+				return fmt.Errorf("could not read last timestamp of %s: %s", path, err)
+			}
+
+			lastTimestamps[strings.ToUpper(symbol)] = lastTimestamp
+		}
+	}
+
+	files := newStreamFiles(intervalHeader, config, func(symbol string, _ time.Time) string {
+		return getFilename(names[symbol], config)
+	})
+	defer files.close()
+
+	err = streamWithReconnect(ctx, config, func() (bool, error) {
+		return streamDerivativeBars(ctx, symbols, lastTimestamps, files, location, config)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return files.close()
+}
+
+// streamDerivativeBars streams until the connection is lost or the context is done, and returns true if any bar was received
+func streamDerivativeBars(ctx context.Context, symbols []string, lastTimestamps map[string]time.Time, files *streamFiles, location *time.Location, config *Config) (received bool, err error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", derivativeAddress(config))
+
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	stopWatch := watchConn(ctx, conn)
+	defer stopWatch()
+
+	requests := []string{fmt.Sprintf("S,SET PROTOCOL,%s", config.Protocol)}
+
+	for _, symbol := range symbols {
+		requests = append(requests, createBarWatchRequest(symbol, lastTimestamps[strings.ToUpper(symbol)], config))
+	}
+
+	for _, request := range requests {
+		log.Debug(request)
+		_, err = fmt.Fprintf(conn, "%s\r\n", request)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	log.WithFields(log.Fields{"symbols": len(symbols), "address": derivativeAddress(config)}).Info("Streaming")
+
+	reader := csv.NewReader(bufio.NewReaderSize(conn, bufferSize))
+	reader.FieldsPerRecord = -1
+	lastSync := time.Now()
+
+	for {
+		iqfeedRow, err := reader.Read()
+
+		if err != nil && ctx.Err() != nil {
+			return received, nil
+		} else if err == io.EOF {
+			return received, errConnectionClosed
+		} else if err != nil {
+			return received, err
+		}
+
+		if config.DetailedLogging {
+			log.Debug(strings.Join(iqfeedRow, ","))
+		}
+
+		switch iqfeedRow[0] {
+		case historyBarMessage, completeBarMessage:
+			symbol, timestamp, row, err := mapLiveBar(iqfeedRow, location, config)
+
+			if err != nil {
+				log.WithError(err).Debug("Skipped bar")
+				break
+			}
+
+			// Bars up to the last written bar are sent again when backfilling after a reconnect
+			if !timestamp.After(lastTimestamps[symbol]) {
+				break
+			}
+
+			err = files.write(symbol, timestamp, row)
+
+			if err != nil {
+				return received, fmt.Errorf("could not write bar: %s", err)
+			}
+
+			lastTimestamps[symbol] = timestamp
+			received = true
+		case updateBarMessage:
+			// Bars in progress are written when completed
+		case notFoundMessage:
+			if len(iqfeedRow) >= 2 {
+				log.WithField("symbol", iqfeedRow[1]).Warn("Symbol not found")
+			}
+		case errorMessage:
+			log.WithField("error", strings.Join(iqfeedRow[1:], ",")).Error("IQFeed error")
+		}
+
+		if time.Since(lastSync) >= syncInterval {
+			err = files.sync()
+
+			if err != nil {
+				return received, fmt.Errorf("could not write bar: %s", err)
+			}
+
+			lastSync = time.Now()
+		}
+	}
+}
+
+// derivativeAddress returns the address of the IQFeed derivative port, 127.0.0.1:9400 by default
+func derivativeAddress(config *Config) string {
+	return address(config.Host, config.DerivativePort, DefaultDerivativePort)
+}
+
+func createBarWatchRequest(symbol string, lastTimestamp time.Time, config *Config) string {
+	// BW,[Symbol],[Interval],[BeginDate BeginTime],[MaxDaysOfDatapoints],[MaxDatapoints],[BeginFilterTime],[EndFilterTime],[RequestID],[IntervalType],[Reserved],[UpdateInterval]<CR><LF>
+	begin := ""
+	maxDays := ""
+
+	if !lastTimestamp.IsZero() {
+		begin = lastTimestamp.In(sourceLocation).Format(requestTimeFormat)
+	} else if len(config.StartDate) == len(requestDateFormat) {
+		begin = config.StartDate + " 000000"
+	} else if config.StartDate != "" {
+		begin = config.StartDate
+	} else {
+		maxDays = "1"
+	}
+
+	return fmt.Sprintf("BW,%s,%d,%s,%s,,,,,%s,,", strings.ToUpper(symbol), config.IntervalLength, begin, maxDays, strings.ToLower(config.IntervalType))
+}
+
+// mapLiveBar maps a history or complete bar message to an interval bar row
+func mapLiveBar(iqfeedRow []string, tz *time.Location, config *Config) (symbol string, timestamp time.Time, outputRow string, err error) {
+	if len(iqfeedRow) < 9 {
+		return "", time.Time{}, "", errTooFewColumns
+	}
+
+	// NOTE: Derivative bars are timestamped at the start of the bar
+	timestamp, err = time.ParseInLocation(secondTimestampFormat, iqfeedRow[2], sourceLocation)
+
+	if err != nil {
+		return "", time.Time{}, "", fmt.Errorf("could not parse live bar timestamp: %s", err)
+	}
+
+	if config.EndTimestamp {
+		timestamp = timestamp.Add(time.Duration(config.IntervalLength) * time.Second)
+	}
+
+	timestamp = timestamp.In(tz)
+
+	// Columns from IQFeed:
+	// 0     1       2          3     4     5    6     7                 8               9
+	// type, symbol, timestamp, open, high, low, last, cumulativeVolume, intervalVolume, numberOfTrades
+	outputRow = fmt.Sprintf("%s,%s,%s,%s,%s,%s",
+		timestamp.Format(secondTimestampFormat), // datetime
+		iqfeedRow[3],                            // open
+		iqfeedRow[4],                            // high
+		iqfeedRow[5],                            // low
+		iqfeedRow[6],                            // close
+		iqfeedRow[8])                            // volume
+
+	if config.TSV {
+		outputRow = strings.Replace(outputRow, csvSeparator, tsvSeparator, -1)
+	}
+
+	return strings.ToUpper(iqfeedRow[1]), timestamp, outputRow, nil
+}
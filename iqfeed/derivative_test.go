@@ -0,0 +1,118 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testHistoryBar  = "BH,SPY,2019-02-26 12:21:00,279.4000,279.5000,279.3000,279.4500,61152110,12000,85,"
+	testCompleteBar = "BC,SPY,2019-02-26 12:22:00,279.4500,279.6000,279.4000,279.5500,61164110,9000,77,"
+	testUpdateBar   = "BU,SPY,2019-02-26 12:23:00,279.5500,279.5500,279.5000,279.5000,61165110,1000,9,"
+)
+
+func TestCreateBarWatchRequest(t *testing.T) {
+	t.Run("start date", func(t *testing.T) {
+		request := createBarWatchRequest("spy", time.Time{}, createConfig(60, "S", false, false))
+
+		assert.Equal(t, "BW,SPY,60,20190122 000000,,,,,,s,,", request)
+	})
+
+	t.Run("today", func(t *testing.T) {
+		config := createConfig(1000, "V", false, false)
+		config.StartDate = ""
+
+		request := createBarWatchRequest("spy", time.Time{}, config)
+
+		assert.Equal(t, "BW,SPY,1000,,1,,,,,v,,", request)
+	})
+
+	t.Run("after last bar", func(t *testing.T) {
+		request := createBarWatchRequest("spy", time.Date(2019, 2, 26, 17, 21, 0, 0, time.UTC), createConfig(60, "S", false, false))
+
+		assert.Equal(t, "BW,SPY,60,20190226 122100,,,,,,s,,", request)
+	})
+}
+
+func TestMapLiveBar(t *testing.T) {
+	t.Run("start timestamp", func(t *testing.T) {
+		symbol, timestamp, row, err := mapLiveBar(strings.Split(testHistoryBar, ","), et, createConfig(60, "S", false, false))
+
+		assert.Equal(t, "SPY", symbol)
+		assert.Equal(t, time.Date(2019, 2, 26, 12, 21, 0, 0, et), timestamp)
+		assert.Equal(t, "2019-02-26 12:21:00,279.4000,279.5000,279.3000,279.4500,12000", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("end timestamp", func(t *testing.T) {
+		_, _, row, err := mapLiveBar(strings.Split(testHistoryBar, ","), et, createConfig(60, "S", true, false))
+
+		assert.Equal(t, "2019-02-26 12:22:00,279.4000,279.5000,279.3000,279.4500,12000", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		_, _, _, err := mapLiveBar([]string{"BH", "SPY"}, et, createConfig(60, "S", false, false))
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+}
+
+func TestStreamBars(t *testing.T) {
+	t.Run("backfill after existing file and append completed bars", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+		requests := make(chan []string, 1)
+
+		go func() {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			scanner := bufio.NewScanner(conn)
+			var received []string
+
+			for len(received) < 2 && scanner.Scan() {
+				received = append(received, strings.TrimRight(scanner.Text(), "\r"))
+			}
+
+			requests <- received
+			_, _ = fmt.Fprintf(conn, "%s\r\n%s\r\n%s\r\n", testHistoryBar, testUpdateBar, testCompleteBar)
+		}()
+
+		config := createConfig(60, "S", false, false)
+		config.OutDirectory = t.TempDir()
+		config.DerivativePort = listener.Addr().(*net.TCPAddr).Port
+		config.ReconnectLimit = 0
+		path := filepath.Join(config.OutDirectory, "spy.csv")
+		_ = os.WriteFile(path, []byte("datetime,open,high,low,close,volume\n2019-02-26 12:20:00,279.4000,279.4000,279.4000,279.4000,100\n"), 0644)
+
+		err := StreamBars(context.Background(), []string{"spy"}, config)
+
+		assert.Equal(t, errConnectionClosed, err)
+		assert.Equal(t, []string{"S,SET PROTOCOL,6.0", "BW,SPY,60,20190226 122000,,,,,,s,,"}, <-requests)
+		assert.Equal(t, "datetime,open,high,low,close,volume\n"+
+			"2019-02-26 12:20:00,279.4000,279.4000,279.4000,279.4000,100\n"+
+			"2019-02-26 12:21:00,279.4000,279.5000,279.3000,279.4500,12000\n"+
+			"2019-02-26 12:22:00,279.4500,279.6000,279.4000,279.5500,9000\n",
+			readTestFile(t, path))
+	})
+
+	t.Run("end timestamps of volume bars", func(t *testing.T) {
+		err := StreamBars(context.Background(), []string{"spy"}, createConfig(1000, "V", true, false))
+
+		assert.NotNil(t, err)
+	})
+}
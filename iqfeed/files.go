@@ -0,0 +1,139 @@
+package iqfeed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// streamFiles appends streamed rows to per-symbol files, which are rotated when the filename for the timestamp
+// of a row changes. Files that already exist are appended to, gzip files with a new member.
+type streamFiles struct {
+	header   string
+	config   *Config
+	filename func(symbol string, timestamp time.Time) string
+	files    map[string]*streamFile
+}
+
+type streamFile struct {
+	path   string
+	file   *os.File
+	writer *textWriter
+}
+
+// newDailyFiles returns files named SYMBOL-yyyy-mm-dd, rotated at midnight in the time zone of the timestamps
+func newDailyFiles(header string, config *Config) *streamFiles {
+	return newStreamFiles(header, config, func(symbol string, timestamp time.Time) string {
+		return getFilename(fmt.Sprintf("%s-%s", strings.ToUpper(symbol), timestamp.Format(dateFormat)), config)
+	})
+}
+
+func newStreamFiles(header string, config *Config, filename func(symbol string, timestamp time.Time) string) *streamFiles {
+	return &streamFiles{header: header, config: config, filename: filename, files: map[string]*streamFile{}}
+}
+
+// write appends a row to the file of the symbol for the timestamp
+func (f *streamFiles) write(symbol string, timestamp time.Time, row string) error {
+	symbol = strings.ToUpper(symbol)
+	path := filepath.Join(f.config.OutDirectory, f.filename(symbol, timestamp))
+	current := f.files[symbol]
+
+	if current != nil && current.path != path {
+		delete(f.files, symbol)
+		err := current.close()
+
+		if err != nil {
+			return err
+		}
+
+		current = nil
+	}
+
+	if current == nil {
+		opened, err := f.open(symbol, path)
+
+		if err != nil {
+			return err
+		}
+
+		f.files[symbol] = opened
+		current = opened
+	}
+
+	return current.writer.writeRow(row)
+}
+
+func (f *streamFiles) open(symbol string, path string) (*streamFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	writer := newTextWriter(file, f.config)
+
+	if info.Size() == 0 {
+		err = writer.writeHeader(f.header)
+
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+
+	log.WithFields(log.Fields{"symbol": symbol, "file": path}).Info("Writing")
+
+	return &streamFile{path: path, file: file, writer: writer}, nil
+}
+
+// sync writes the buffered rows of all files, so they can be read while streaming
+func (f *streamFiles) sync() error {
+	for _, file := range f.files {
+		err := file.writer.sync()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close completes and closes all files
+func (f *streamFiles) close() error {
+	var closeErr error
+
+	for symbol, file := range f.files {
+		err := file.close()
+
+		if err != nil && closeErr == nil {
+			closeErr = err
+		}
+
+		delete(f.files, symbol)
+	}
+
+	return closeErr
+}
+
+func (f *streamFile) close() error {
+	err := f.writer.flush()
+	closeErr := f.file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
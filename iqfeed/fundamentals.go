@@ -0,0 +1,318 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	fundamentalMessage  = "F"
+	fundamentalDate     = "01/02/2006"
+	fundamentalWatches  = 100
+	fundamentalsTimeout = 30 * time.Second
+	fundamentalsHeader  = "symbol,name,exchange,market,type,sic,naics,last,shares,pe,eps,avgvolume," +
+		"high52,high52date,low52,low52date,dividend,dividendrate,yield,paydate,exdate,split1,split1date,split2,split2date"
+)
+
+// fundamentals is the fundamental data of a symbol with the last trade price, dates are formatted yyyy-mm-dd
+type fundamentals struct {
+	symbol        string
+	name          string
+	exchange      string
+	market        string
+	securityType  string
+	sic           string
+	naics         string
+	last          string
+	shares        string
+	pe            string
+	eps           string
+	averageVolume string
+	high52        string
+	high52Date    string
+	low52         string
+	low52Date     string
+	dividend      string
+	dividendRate  string
+	dividendYield string
+	payDate       string
+	exDate        string
+	split1        string
+	split1Date    string
+	split2        string
+	split2Date    string
+}
+
+// DownloadFundamentals requests the fundamental data of the symbols on the Level 1 port and writes one row
+// per symbol to a fundamentals file, replacing the file of an earlier download. Symbols not found are skipped.
+func DownloadFundamentals(ctx context.Context, symbols []string, config *Config) error {
+	found, err := requestFundamentals(ctx, symbols, config)
+
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(config.OutDirectory, getFilename("fundamentals", config))
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("could not create file: %s", err)
+	}
+	defer file.Close()
+
+	writer := newTextWriter(file, config)
+	err = writer.writeHeader(fundamentalsHeader)
+
+	for _, symbol := range symbols {
+		data, exists := found[strings.ToUpper(symbol)]
+
+		if !exists || err != nil {
+			continue
+		}
+
+		err = writer.writeRow(formatFundamentals(data, config))
+	}
+
+	if err == nil {
+		err = writer.flush()
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write fundamentals: %s", err)
+	}
+
+	log.WithFields(log.Fields{"symbols": len(found), "file": path}).Info("Wrote fundamentals")
+	return file.Close()
+}
+
+// requestFundamentals watches the symbols until their fundamental and summary messages are received,
+// keeping at most fundamentalWatches symbols watched at a time
+func requestFundamentals(ctx context.Context, symbols []string, config *Config) (map[string]fundamentals, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", level1Address(config))
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stopWatch := watchConn(ctx, conn)
+	defer stopWatch()
+
+	send := func(request string) error {
+		_, err := fmt.Fprintf(conn, "%s\r\n", request)
+		return err
+	}
+
+	err = send(fmt.Sprintf("S,SET PROTOCOL,%s", config.Protocol))
+
+	if err == nil {
+		err = send("S,SELECT UPDATE FIELDS,Most Recent Trade")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make([]string, 0, len(symbols))
+
+	for _, symbol := range symbols {
+		queue = append(queue, strings.ToUpper(symbol))
+	}
+
+	watched := map[string]*fundamentals{}
+	found := map[string]fundamentals{}
+
+	// watchNext replaces a completed symbol with the next symbol of the queue
+	watchNext := func() error {
+		for len(watched) < fundamentalWatches && len(queue) > 0 {
+			symbol := queue[0]
+			queue = queue[1:]
+
+			if _, exists := watched[symbol]; exists {
+				continue
+			}
+
+			watched[symbol] = nil
+			err := send(fmt.Sprintf("w%s", symbol))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err = watchNext()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bufio.NewReaderSize(conn, bufferSize))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	for len(watched) > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(fundamentalsTimeout))
+		iqfeedRow, err := reader.Read()
+
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		} else if err == io.EOF {
+			return nil, errConnectionClosed
+		} else if err, ok := err.(net.Error); ok && err.Timeout() {
+			return nil, fmt.Errorf("timed out waiting for fundamentals of %d symbols", len(watched))
+		} else if err != nil {
+			return nil, err
+		}
+
+		if config.DetailedLogging {
+			log.Debug(strings.Join(iqfeedRow, ","))
+		}
+
+		if len(iqfeedRow) < 2 {
+			continue
+		}
+
+		symbol := strings.ToUpper(iqfeedRow[1])
+		data, exists := watched[symbol]
+
+		if !exists {
+			continue
+		}
+
+		switch iqfeedRow[0] {
+		case fundamentalMessage:
+			parsed, err := mapFundamentals(iqfeedRow)
+
+			if err != nil {
+				return nil, fmt.Errorf("could not map fundamentals of %s: %s", symbol, err)
+			}
+
+			watched[symbol] = &parsed
+			continue
+		case summaryMessage:
+			// The summary message follows the fundamental message
+			if data == nil {
+				continue
+			}
+
+			if len(iqfeedRow) >= 3 {
+				data.last = iqfeedRow[2]
+			}
+
+			found[symbol] = *data
+		case notFoundMessage:
+			log.WithField("symbol", symbol).Warn("Symbol not found")
+		default:
+			continue
+		}
+
+		delete(watched, symbol)
+		err = send(fmt.Sprintf("r%s", symbol))
+
+		if err == nil {
+			err = watchNext()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+// mapFundamentals maps a fundamental message
+func mapFundamentals(iqfeedRow []string) (fundamentals, error) {
+	if len(iqfeedRow) < 55 {
+		return fundamentals{}, errTooFewColumns
+	}
+
+	// Columns from IQFeed (reserved columns left out):
+	// 0     1       2           3   4              5           6          7            8           9              10              11
+	// type, symbol, exchangeId, pe, averageVolume, 52WeekHigh, 52WeekLow, calendarHigh, calendarLow, dividendYield, dividendAmount, dividendRate,
+	// 12       13              17              19              20           21               22             24           25
+	// payDate, exDividendDate, shortInterest, currentYearEps, nextYearEps, fiveYearGrowth, fiscalYearEnd, companyName, rootOptionSymbol,
+	// 26                    27    28     29             30                  31                32             33
+	// institutionalPercent, beta, leaps, currentAssets, currentLiabilities, balanceSheetDate, longTermDebt, commonSharesOutstanding,
+	// 35            36            39          40         41   42                    43            44            45              46
+	// splitFactor1, splitFactor2, formatCode, precision, sic, historicalVolatility, securityType, listedMarket, 52WeekHighDate, 52WeekLowDate,
+	// 47                48               49            50            51          52              53           54
+	// calendarHighDate, calendarLowDate, yearEndClose, maturityDate, couponRate, expirationDate, strikePrice, naics
+	split1, split1Date := splitFactor(iqfeedRow[35])
+	split2, split2Date := splitFactor(iqfeedRow[36])
+
+	return fundamentals{
+		symbol:        strings.ToUpper(iqfeedRow[1]),
+		name:          strings.TrimSpace(iqfeedRow[24]),
+		exchange:      iqfeedRow[2],
+		market:        iqfeedRow[44],
+		securityType:  iqfeedRow[43],
+		sic:           iqfeedRow[41],
+		naics:         iqfeedRow[54],
+		shares:        iqfeedRow[33],
+		pe:            iqfeedRow[3],
+		eps:           iqfeedRow[19],
+		averageVolume: iqfeedRow[4],
+		high52:        iqfeedRow[5],
+		high52Date:    convertFundamentalDate(iqfeedRow[45]),
+		low52:         iqfeedRow[6],
+		low52Date:     convertFundamentalDate(iqfeedRow[46]),
+		dividend:      iqfeedRow[10],
+		dividendRate:  iqfeedRow[11],
+		dividendYield: iqfeedRow[9],
+		payDate:       convertFundamentalDate(iqfeedRow[12]),
+		exDate:        convertFundamentalDate(iqfeedRow[13]),
+		split1:        split1,
+		split1Date:    split1Date,
+		split2:        split2,
+		split2Date:    split2Date,
+	}, nil
+}
+
+// splitFactor returns the factor and date of a split, sent as a factor and a date separated by a space
+func splitFactor(value string) (factor string, date string) {
+	parts := strings.Fields(value)
+
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], convertFundamentalDate(parts[1])
+}
+
+// convertFundamentalDate converts a mm/dd/yyyy date to yyyy-mm-dd, or an empty string when there is no valid date
+func convertFundamentalDate(value string) string {
+	date, err := time.Parse(fundamentalDate, strings.TrimSpace(value))
+
+	if err != nil {
+		return ""
+	}
+
+	return date.Format(dateFormat)
+}
+
+func formatFundamentals(data fundamentals, config *Config) string {
+	// Company names can contain the separator
+	name := strings.NewReplacer(csvSeparator, " ", tsvSeparator, " ").Replace(data.name)
+
+	return joinColumns(config,
+		data.symbol, name, data.exchange, data.market, data.securityType, data.sic, data.naics,
+		data.last, data.shares, data.pe, data.eps, data.averageVolume,
+		data.high52, data.high52Date, data.low52, data.low52Date,
+		data.dividend, data.dividendRate, data.dividendYield, data.payDate, data.exDate,
+		data.split1, data.split1Date, data.split2, data.split2Date)
+}
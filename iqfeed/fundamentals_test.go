@@ -0,0 +1,139 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFundamentals = "F,AAPL,5,16.5,27000000,233.47,142.00,233.47,154.11,1.25,0.77,3.08,08/15/2019,08/12/2019,,,,50000,,11.89,12.5,10.2,09,," +
+	"APPLE INC,AAPL,60.1,1.2,,162819.0,105718.0,06/29/2019,84936.0,4601075,,0.14 06/09/2014,0.50 02/28/2005,,,14,4,3571,25.5,1,5," +
+	"09/18/2019,12/24/2018,09/18/2019,01/03/2019,157.74,,,,,334111,AAPL,"
+
+func TestMapFundamentals(t *testing.T) {
+	t.Run("fundamental message", func(t *testing.T) {
+		data, err := mapFundamentals(strings.Split(testFundamentals, ","))
+
+		assert.Equal(t, fundamentals{
+			symbol:        "AAPL",
+			name:          "APPLE INC",
+			exchange:      "5",
+			market:        "5",
+			securityType:  "1",
+			sic:           "3571",
+			naics:         "334111",
+			shares:        "4601075",
+			pe:            "16.5",
+			eps:           "11.89",
+			averageVolume: "27000000",
+			high52:        "233.47",
+			high52Date:    "2019-09-18",
+			low52:         "142.00",
+			low52Date:     "2018-12-24",
+			dividend:      "0.77",
+			dividendRate:  "3.08",
+			dividendYield: "1.25",
+			payDate:       "2019-08-15",
+			exDate:        "2019-08-12",
+			split1:        "0.14",
+			split1Date:    "2014-06-09",
+			split2:        "0.50",
+			split2Date:    "2005-02-28",
+		}, data)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		_, err := mapFundamentals([]string{"F", "AAPL", "5"})
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+}
+
+func TestSplitFactor(t *testing.T) {
+	t.Run("factor and date", func(t *testing.T) {
+		factor, date := splitFactor("0.50 02/28/2005")
+
+		assert.Equal(t, "0.50", factor)
+		assert.Equal(t, "2005-02-28", date)
+	})
+
+	t.Run("no split", func(t *testing.T) {
+		factor, date := splitFactor("")
+
+		assert.Equal(t, "", factor)
+		assert.Equal(t, "", date)
+	})
+}
+
+func TestDownloadFundamentals(t *testing.T) {
+	t.Run("write a row per found symbol", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+		requests := make(chan []string, 1)
+
+		go func() {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			var received []string
+			scanner := bufio.NewScanner(conn)
+
+			for scanner.Scan() {
+				received = append(received, strings.TrimRight(scanner.Text(), "\r"))
+
+				if len(received) == 4 {
+					_, _ = fmt.Fprintf(conn, "n,BAD\r\n%s\r\nP,AAPL,221.0300,\r\n", testFundamentals)
+				} else if len(received) == 6 {
+					break
+				}
+			}
+
+			requests <- received
+		}()
+
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.Level1Port = listener.Addr().(*net.TCPAddr).Port
+
+		err := DownloadFundamentals(context.Background(), []string{"aapl", "bad"}, config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"S,SET PROTOCOL,5.1", "S,SELECT UPDATE FIELDS,Most Recent Trade", "wAAPL", "wBAD", "rBAD", "rAAPL"}, <-requests)
+		assert.Equal(t, fundamentalsHeader+"\n"+
+			"AAPL,APPLE INC,5,5,1,3571,334111,221.0300,4601075,16.5,11.89,27000000,233.47,2019-09-18,142.00,2018-12-24,"+
+			"0.77,3.08,1.25,2019-08-15,2019-08-12,0.14,2014-06-09,0.50,2005-02-28\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "fundamentals.csv")))
+	})
+
+	t.Run("connection closed", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+
+		go func() {
+			conn, err := listener.Accept()
+
+			if err == nil {
+				_ = conn.Close()
+			}
+		}()
+
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.Level1Port = listener.Addr().(*net.TCPAddr).Port
+
+		err := DownloadFundamentals(context.Background(), []string{"aapl"}, config)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,539 @@
+package iqfeed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	RollVolume       = "volume"
+	RollOpenInterest = "oi"
+	RollDays         = "days"
+
+	RollAdjustNone       = "none"
+	RollAdjustDifference = "difference"
+	RollAdjustRatio      = "ratio"
+
+	// FuturesMonths are the futures month codes from January to December
+	FuturesMonths = "FGHJKMNQUVXZ"
+
+	rollLogHeader = "date,from,to,fromclose,toclose,adjustment"
+)
+
+// contractSeries is the downloaded bars of a futures contract with the daily volume, open interest and close
+type contractSeries struct {
+	symbol string
+	header string
+	rows   [][]string
+	// rowDates are the dates of the rows, and dates the trading days
+	rowDates []string
+	dates    []string
+	daily    map[string]dailyStats
+}
+
+type dailyStats struct {
+	volume       int64
+	openInterest int64
+	close        float64
+}
+
+// contractRoll is a switch to the next contract, the bars of the new contract are used from the date
+type contractRoll struct {
+	date      string
+	from      int
+	to        int
+	fromClose float64
+	toClose   float64
+}
+
+// ValidateFutures checks the roll options of a continuous futures download
+func ValidateFutures(config *Config) error {
+	config.Roll = strings.ToLower(config.Roll)
+	config.RollAdjustment = strings.ToLower(config.RollAdjustment)
+	config.ContractMonths = strings.ToUpper(config.ContractMonths)
+
+	command := strings.ToLower(config.Command)
+
+	if command != "eod" && command != "minute" {
+		return fmt.Errorf("continuous futures are only supported for eod and minute bars")
+	}
+
+	switch config.Roll {
+	case RollVolume, RollDays:
+	case RollOpenInterest:
+		if command != "eod" {
+			return fmt.Errorf("open interest rolls are only supported for eod bars")
+		}
+	default:
+		return fmt.Errorf("unsupported roll rule: %s", config.Roll)
+	}
+
+	switch config.RollAdjustment {
+	case RollAdjustNone, RollAdjustDifference, RollAdjustRatio:
+	default:
+		return fmt.Errorf("unsupported roll adjustment: %s", config.RollAdjustment)
+	}
+
+	if config.RollDays < 0 {
+		return fmt.Errorf("incorrect roll days: %d", config.RollDays)
+	}
+
+	if config.ContractMonths == "" {
+		return fmt.Errorf("no contract months")
+	}
+
+	for _, month := range config.ContractMonths {
+		if !strings.ContainsRune(FuturesMonths, month) {
+			return fmt.Errorf("unknown contract month code: %c", month)
+		}
+	}
+
+	if config.StartDate == "" {
+		return fmt.Errorf("continuous futures require a start date")
+	}
+
+	return nil
+}
+
+// FuturesContracts expands a futures root such as @ES into the contract symbols of the contract months,
+// in expiry order from the year of the start date to the year after the end date, for example @ESH19
+func FuturesContracts(root string, config *Config, now time.Time) ([]string, error) {
+	start, err := parseRequestTime(config.StartDate, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	end := now
+
+	if config.EndDate != "" {
+		end, err = parseRequestTime(config.EndDate, true)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var contracts []string
+
+	for year := start.Year(); year <= end.Year()+1; year++ {
+		for _, month := range FuturesMonths {
+			if strings.ContainsRune(config.ContractMonths, month) {
+				contracts = append(contracts, fmt.Sprintf("%s%c%02d", strings.ToUpper(root), month, year%100))
+			}
+		}
+	}
+
+	return contracts, nil
+}
+
+// DownloadContract returns a download function for the contracts of a futures root, which reports contracts
+// unknown to IQFeed as no data instead of failed. Not every root trades every contract month, for example @ES only
+// has quarterly contracts, so the contracts of the default months include symbols that do not exist.
+func DownloadContract(downloadFunc DownloadFunc) DownloadFunc {
+	return func(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+		result := downloadFunc(ctx, symbol, connection, config)
+
+		if result.Status == StatusFailed && isInvalidSymbol(result.Err) {
+			log.WithField("symbol", strings.ToUpper(symbol)).Info("No such contract")
+			result.Status = StatusNoData
+			result.Err = nil
+		}
+
+		return result
+	}
+}
+
+// BuildContinuous stitches the downloaded contract files, in expiry order, into a continuous series rolled with
+// the roll rule of the config and back-adjusted at the rolls. The series is written to a ROOT-continuous file
+// with the contract of each bar, and the rolls to a ROOT-rolls file. Contracts without a file are skipped.
+func BuildContinuous(root string, contracts []string, config *Config) error {
+	var series []*contractSeries
+
+	for _, contract := range contracts {
+		path := filepath.Join(config.OutDirectory, getFilename(contract, config))
+
+		if !fileExists(path) {
+			continue
+		}
+
+		loaded, err := readContractSeries(contract, path, config)
+
+		if err != nil {
+			return fmt.Errorf("could not read %s: %s", path, err)
+		}
+
+		if len(loaded.rows) > 0 {
+			series = append(series, loaded)
+		}
+	}
+
+	if len(series) == 0 {
+		return fmt.Errorf("no contract data for %s", strings.ToUpper(root))
+	}
+
+	rolls := planRolls(series, config)
+	root = strings.ToUpper(root)
+
+	err := writeContinuous(filepath.Join(config.OutDirectory, getFilename(root+"-continuous", config)), series, rolls, config)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeRollLog(filepath.Join(config.OutDirectory, getFilename(root+"-rolls", config)), series, rolls, config)
+
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"root": root, "contracts": len(series), "rolls": len(rolls)}).Info("Built continuous series")
+	return nil
+}
+
+func readContractSeries(symbol string, path string, config *Config) (*contractSeries, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if config.Gzip {
+		gzipReader, err := gzip.NewReader(file)
+
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	}
+
+	separator := csvSeparator
+
+	if config.TSV {
+		separator = tsvSeparator
+	}
+
+	location, err := LoadLocation(config.TimeZone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := &contractSeries{symbol: symbol, daily: map[string]dailyStats{}}
+	scanner := bufio.NewScanner(reader)
+	var input *Config
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if line == "" {
+			continue
+		}
+
+		if loaded.header == "" {
+			loaded.header = line
+			continue
+		}
+
+		// Columns: date or datetime, open, high, low, close, volume and for daily bars oi
+		row := strings.Split(line, separator)
+
+		if len(row) < 6 {
+			return nil, errTooFewColumns
+		}
+
+		// Contracts downloaded earlier may have another time format than the continuous series
+		if input == nil {
+			input = inputTimeFormat(row[0], config)
+		}
+
+		timestamp, err := parseFormattedTimestamp(row[0], location, input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The rows are written as read, so their timestamps are converted to the time format of the series
+		if input.TimeFormat != config.TimeFormat {
+			layout := secondTimestampFormat
+
+			if strings.HasPrefix(loaded.header, "date"+separator) {
+				layout = dateFormat
+			}
+
+			row[0] = formatTimestamp(timestamp, layout, config)
+		}
+
+		parser := fieldParser{}
+		date := timestamp.Format(dateFormat)
+		stats := loaded.daily[date]
+		stats.volume += parser.int(row[5])
+		stats.close = parser.float(row[4])
+
+		if len(row) > 6 {
+			stats.openInterest = parser.int(row[6])
+		}
+
+		if parser.err != nil {
+			return nil, parser.err
+		}
+
+		if len(loaded.dates) == 0 || loaded.dates[len(loaded.dates)-1] != date {
+			loaded.dates = append(loaded.dates, date)
+		}
+
+		loaded.daily[date] = stats
+		loaded.rows = append(loaded.rows, row)
+		loaded.rowDates = append(loaded.rowDates, date)
+	}
+
+	return loaded, scanner.Err()
+}
+
+// planRolls walks the trading days of all contracts and rolls to the next contract after the close of the day
+// the roll rule is met, or on the first day after the active contract expired
+func planRolls(series []*contractSeries, config *Config) []contractRoll {
+	dateSet := map[string]bool{}
+
+	for _, contract := range series {
+		for _, date := range contract.dates {
+			dateSet[date] = true
+		}
+	}
+
+	dates := make([]string, 0, len(dateSet))
+
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+
+	sort.Strings(dates)
+	lastDate := dates[len(dates)-1]
+
+	var rolls []contractRoll
+	active := 0
+
+	for i, date := range dates {
+		// The active contract expired without meeting the roll rule
+		for active < len(series)-1 && date > series[active].lastDate() {
+			expiry := series[active].lastDate()
+			rolls = append(rolls, newContractRoll(date, expiry, active, active+1, series))
+			active++
+		}
+
+		if active == len(series)-1 || i == len(dates)-1 {
+			continue
+		}
+
+		current := series[active]
+		next := series[active+1]
+		currentStats, currentTraded := current.daily[date]
+		nextStats, nextTraded := next.daily[date]
+		roll := false
+
+		switch config.Roll {
+		case RollVolume:
+			roll = currentTraded && nextTraded && nextStats.volume > currentStats.volume
+		case RollOpenInterest:
+			roll = currentTraded && nextTraded && nextStats.openInterest > currentStats.openInterest
+		case RollDays:
+			// The last date of a contract still trading at the end of the data is not its expiry
+			remaining := len(current.dates) - 1 - sort.SearchStrings(current.dates, date)
+			roll = currentTraded && current.lastDate() < lastDate && remaining <= config.RollDays
+		}
+
+		if roll {
+			rolls = append(rolls, newContractRoll(dates[i+1], date, active, active+1, series))
+			active++
+		}
+	}
+
+	return rolls
+}
+
+// newContractRoll creates a roll from the close of the day before, using the last close of the new contract
+// at or before that day, or its first close when it had not traded yet
+func newContractRoll(date string, closeDate string, from int, to int, series []*contractSeries) contractRoll {
+	roll := contractRoll{date: date, from: from, to: to, fromClose: series[from].closeAt(closeDate), toClose: series[to].closeAt(closeDate)}
+
+	if roll.toClose == 0 {
+		roll.toClose = series[to].daily[series[to].dates[0]].close
+	}
+
+	return roll
+}
+
+func (s *contractSeries) lastDate() string {
+	return s.dates[len(s.dates)-1]
+}
+
+// closeAt returns the last close at or before the date, or zero when the contract had not traded yet
+func (s *contractSeries) closeAt(date string) float64 {
+	index := sort.SearchStrings(s.dates, date)
+
+	if index < len(s.dates) && s.dates[index] == date {
+		return s.daily[date].close
+	} else if index == 0 {
+		return 0
+	}
+
+	return s.daily[s.dates[index-1]].close
+}
+
+// rollAdjustment returns the difference or ratio of the closes at a roll
+func rollAdjustment(roll contractRoll, config *Config) float64 {
+	switch config.RollAdjustment {
+	case RollAdjustDifference:
+		return roll.toClose - roll.fromClose
+	case RollAdjustRatio:
+		if roll.fromClose == 0 {
+			return 1
+		}
+
+		return roll.toClose / roll.fromClose
+	}
+
+	return 0
+}
+
+func writeContinuous(path string, series []*contractSeries, rolls []contractRoll, config *Config) error {
+	separator := csvSeparator
+
+	if config.TSV {
+		separator = tsvSeparator
+	}
+
+	// Segments of the series, each contract is used from its roll date until the next roll
+	type segment struct {
+		contract   int
+		start      string
+		end        string
+		difference float64
+		ratio      float64
+	}
+
+	segments := []segment{{contract: 0}}
+
+	for _, roll := range rolls {
+		segments[len(segments)-1].end = roll.date
+		segments = append(segments, segment{contract: roll.to, start: roll.date})
+	}
+
+	// Back-adjust every segment by the adjustments of all later rolls
+	difference := 0.0
+	ratio := 1.0
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		segments[i].difference = difference
+		segments[i].ratio = ratio
+
+		if i > 0 {
+			adjustment := rollAdjustment(rolls[i-1], config)
+
+			if config.RollAdjustment == RollAdjustDifference {
+				difference += adjustment
+			} else if config.RollAdjustment == RollAdjustRatio {
+				ratio *= adjustment
+			}
+		}
+	}
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("could not create file: %s", err)
+	}
+	defer file.Close()
+
+	writer := newTextWriter(file, config)
+	err = writer.writeHeader(strings.Replace(series[0].header, tsvSeparator, csvSeparator, -1) + ",contract")
+
+	for _, s := range segments {
+		contract := series[s.contract]
+
+		for i, row := range contract.rows {
+			date := contract.rowDates[i]
+
+			if date < s.start || (s.end != "" && date >= s.end) || err != nil {
+				continue
+			}
+
+			columns := append([]string{}, row...)
+
+			if config.RollAdjustment != RollAdjustNone {
+				for column := 1; column <= 4; column++ {
+					price, parseErr := strconv.ParseFloat(columns[column], 64)
+
+					if parseErr == nil {
+						columns[column] = strconv.FormatFloat(price*s.ratio+s.difference, 'f', 4, 64)
+					}
+				}
+			}
+
+			err = writer.writeRow(strings.Join(append(columns, contract.symbol), separator))
+		}
+	}
+
+	if err == nil {
+		err = writer.flush()
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write continuous series: %s", err)
+	}
+
+	return file.Close()
+}
+
+func writeRollLog(path string, series []*contractSeries, rolls []contractRoll, config *Config) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("could not create file: %s", err)
+	}
+	defer file.Close()
+
+	writer := newTextWriter(file, config)
+	err = writer.writeHeader(rollLogHeader)
+
+	for _, roll := range rolls {
+		if err != nil {
+			break
+		}
+
+		adjustment := ""
+
+		if config.RollAdjustment != RollAdjustNone {
+			adjustment = strconv.FormatFloat(rollAdjustment(roll, config), 'f', -1, 64)
+		}
+
+		err = writer.writeRow(joinColumns(config, roll.date, series[roll.from].symbol, series[roll.to].symbol,
+			strconv.FormatFloat(roll.fromClose, 'f', -1, 64), strconv.FormatFloat(roll.toClose, 'f', -1, 64), adjustment))
+	}
+
+	if err == nil {
+		err = writer.flush()
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write roll log: %s", err)
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,210 @@
+package iqfeed
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testFrontContract = "date,open,high,low,close,volume,oi\n" +
+		"2019-03-11,2780.00,2790.00,2770.00,2785.00,900,5000\n" +
+		"2019-03-12,2785.00,2795.00,2780.00,2790.00,800,4000\n" +
+		"2019-03-13,2790.00,2800.00,2785.00,2795.00,300,2000\n" +
+		"2019-03-14,2795.00,2805.00,2790.00,2800.00,100,1000\n"
+	testBackContract = "date,open,high,low,close,volume,oi\n" +
+		"2019-03-11,2790.00,2800.00,2780.00,2795.00,500,3000\n" +
+		"2019-03-12,2795.00,2805.00,2790.00,2800.00,700,4500\n" +
+		"2019-03-13,2800.00,2810.00,2795.00,2810.00,900,6000\n" +
+		"2019-03-14,2810.00,2815.00,2800.00,2812.00,950,7000\n" +
+		"2019-03-15,2812.00,2820.00,2805.00,2815.00,990,7100\n"
+)
+
+func createFuturesConfig(t *testing.T, roll string, adjustment string) *Config {
+	config := createConfig(0, "", false, false)
+	config.Command = "eod"
+	config.OutDirectory = t.TempDir()
+	config.ContractMonths = "HM"
+	config.Roll = roll
+	config.RollDays = 1
+	config.RollAdjustment = adjustment
+
+	_ = os.WriteFile(filepath.Join(config.OutDirectory, "@ESH19.csv"), []byte(testFrontContract), 0644)
+	_ = os.WriteFile(filepath.Join(config.OutDirectory, "@ESM19.csv"), []byte(testBackContract), 0644)
+
+	return config
+}
+
+func TestValidateFutures(t *testing.T) {
+	t.Run("valid options", func(t *testing.T) {
+		config := createFuturesConfig(t, "VOLUME", "Ratio")
+		config.ContractMonths = "hmuz"
+
+		err := ValidateFutures(config)
+
+		assert.Equal(t, RollVolume, config.Roll)
+		assert.Equal(t, RollAdjustRatio, config.RollAdjustment)
+		assert.Equal(t, "HMUZ", config.ContractMonths)
+		assert.Nil(t, err)
+	})
+
+	t.Run("open interest roll of minute bars", func(t *testing.T) {
+		config := createFuturesConfig(t, RollOpenInterest, RollAdjustNone)
+		config.Command = "minute"
+
+		assert.NotNil(t, ValidateFutures(config))
+	})
+
+	t.Run("unknown month code", func(t *testing.T) {
+		config := createFuturesConfig(t, RollVolume, RollAdjustNone)
+		config.ContractMonths = "HA"
+
+		assert.NotNil(t, ValidateFutures(config))
+	})
+
+	t.Run("unsupported adjustment", func(t *testing.T) {
+		assert.NotNil(t, ValidateFutures(createFuturesConfig(t, RollVolume, "panama")))
+	})
+}
+
+func TestFuturesContracts(t *testing.T) {
+	config := createConfig(0, "", false, false)
+	config.StartDate = "20181201"
+	config.EndDate = "20190115"
+	config.ContractMonths = "ZH"
+
+	contracts, err := FuturesContracts("@es", config, time.Now())
+
+	assert.Equal(t, []string{"@ESH18", "@ESZ18", "@ESH19", "@ESZ19", "@ESH20", "@ESZ20"}, contracts)
+	assert.Nil(t, err)
+}
+
+func TestBuildContinuous(t *testing.T) {
+	t.Run("volume roll with difference adjustment", func(t *testing.T) {
+		config := createFuturesConfig(t, RollVolume, RollAdjustDifference)
+
+		err := BuildContinuous("@es", []string{"@ESZ18", "@ESH19", "@ESM19"}, config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "date,open,high,low,close,volume,oi,contract\n"+
+			"2019-03-11,2795.0000,2805.0000,2785.0000,2800.0000,900,5000,@ESH19\n"+
+			"2019-03-12,2800.0000,2810.0000,2795.0000,2805.0000,800,4000,@ESH19\n"+
+			"2019-03-13,2805.0000,2815.0000,2800.0000,2810.0000,300,2000,@ESH19\n"+
+			"2019-03-14,2810.0000,2815.0000,2800.0000,2812.0000,950,7000,@ESM19\n"+
+			"2019-03-15,2812.0000,2820.0000,2805.0000,2815.0000,990,7100,@ESM19\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-continuous.csv")))
+		assert.Equal(t, rollLogHeader+"\n2019-03-14,@ESH19,@ESM19,2795,2810,15\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-rolls.csv")))
+	})
+
+	t.Run("open interest roll with ratio adjustment", func(t *testing.T) {
+		config := createFuturesConfig(t, RollOpenInterest, RollAdjustRatio)
+
+		err := BuildContinuous("@ES", []string{"@ESH19", "@ESM19"}, config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "date,open,high,low,close,volume,oi,contract\n"+
+			"2019-03-11,2789.9642,2800.0000,2779.9283,2794.9821,900,5000,@ESH19\n"+
+			"2019-03-12,2794.9821,2805.0179,2789.9642,2800.0000,800,4000,@ESH19\n"+
+			"2019-03-13,2800.0000,2810.0000,2795.0000,2810.0000,900,6000,@ESM19\n"+
+			"2019-03-14,2810.0000,2815.0000,2800.0000,2812.0000,950,7000,@ESM19\n"+
+			"2019-03-15,2812.0000,2820.0000,2805.0000,2815.0000,990,7100,@ESM19\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-continuous.csv")))
+	})
+
+	t.Run("roll days before expiry without adjustment", func(t *testing.T) {
+		config := createFuturesConfig(t, RollDays, RollAdjustNone)
+
+		err := BuildContinuous("@ES", []string{"@ESH19", "@ESM19"}, config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, rollLogHeader+"\n2019-03-14,@ESH19,@ESM19,2795,2810,\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-rolls.csv")))
+	})
+
+	t.Run("roll at expiry", func(t *testing.T) {
+		config := createFuturesConfig(t, RollDays, RollAdjustNone)
+		config.RollDays = 0
+
+		err := BuildContinuous("@ES", []string{"@ESH19", "@ESM19"}, config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, rollLogHeader+"\n2019-03-15,@ESH19,@ESM19,2800,2812,\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-rolls.csv")))
+	})
+
+	t.Run("iqfeed contracts to epoch series", func(t *testing.T) {
+		config := createFuturesConfig(t, RollDays, RollAdjustNone)
+		config.TimeFormat = TimeFormatEpochSeconds
+
+		err := BuildContinuous("@ES", []string{"@ESH19", "@ESM19"}, config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "date,open,high,low,close,volume,oi,contract\n"+
+			"1552276800,2780.00,2790.00,2770.00,2785.00,900,5000,@ESH19\n"+
+			"1552363200,2785.00,2795.00,2780.00,2790.00,800,4000,@ESH19\n"+
+			"1552449600,2790.00,2800.00,2785.00,2795.00,300,2000,@ESH19\n"+
+			"1552536000,2810.00,2815.00,2800.00,2812.00,950,7000,@ESM19\n"+
+			"1552622400,2812.00,2820.00,2805.00,2815.00,990,7100,@ESM19\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-continuous.csv")))
+	})
+
+	t.Run("no contract data", func(t *testing.T) {
+		config := createFuturesConfig(t, RollVolume, RollAdjustNone)
+
+		err := BuildContinuous("@NQ", []string{"@NQH19"}, config)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFuturesIntegration(t *testing.T) {
+	t.Run("quarterly contracts of the default contract months", func(t *testing.T) {
+		_, config := startTestServer(t, func(request iqfeedtest.Request) iqfeedtest.Response {
+			switch request.Symbol {
+			case "@ESH19":
+				return iqfeedtest.Response{Rows: []string{
+					"2019-03-13,2800.00,2785.00,2790.00,2795.00,300,2000,",
+					"2019-03-14,2805.00,2790.00,2795.00,2800.00,100,1000,",
+				}}
+			case "@ESM19":
+				return iqfeedtest.Response{Rows: []string{
+					"2019-03-13,2810.00,2795.00,2800.00,2810.00,900,6000,",
+					"2019-03-14,2815.00,2800.00,2810.00,2812.00,950,7000,",
+				}}
+			case "@ESU19", "@ESZ19", "@ESH20", "@ESM20", "@ESU20", "@ESZ20":
+				return iqfeedtest.Response{Error: "!NO_DATA!"}
+			}
+
+			return iqfeedtest.Response{Error: "Invalid symbol."}
+		})
+		config.Command = "eod"
+		config.StartDate = "20190313"
+		config.EndDate = "20190314"
+		config.ContractMonths = FuturesMonths
+		config.Roll = RollVolume
+		config.RollAdjustment = RollAdjustNone
+
+		contracts, _ := FuturesContracts("@es", config, time.Now())
+		connection := &Conn{}
+		statuses := map[DownloadStatus]int{}
+
+		for _, contract := range contracts {
+			result := DownloadWithRetry(context.Background(), contract, connection, config, DownloadContract(DownloadEod))
+			statuses[result.Status]++
+		}
+
+		err := BuildContinuous("@es", contracts, config)
+
+		assert.Equal(t, 24, len(contracts))
+		assert.Equal(t, map[DownloadStatus]int{StatusSuccess: 2, StatusNoData: 22}, statuses)
+		assert.Nil(t, err)
+		assert.Equal(t, rollLogHeader+"\n2019-03-14,@ESH19,@ESM19,2795,2810,\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "@ES-rolls.csv")))
+	})
+}
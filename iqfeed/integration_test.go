@@ -0,0 +1,402 @@
+package iqfeed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testEodRows = []string{
+		"2019-02-21,24.0600,23.8038,23.8700,24.0000,29183,0,",
+		"2019-02-22,24.1000,23.9000,23.9500,24.0500,31022,0,",
+	}
+	testEodFile = "date,open,high,low,close,volume,oi\n" +
+		"2019-02-21,23.8700,24.0600,23.8038,24.0000,29183,0\n" +
+		"2019-02-22,23.9500,24.1000,23.9000,24.0500,31022,0\n"
+)
+
+func startTestServer(t *testing.T, handler iqfeedtest.Handler) (*iqfeedtest.Server, *Config) {
+	server := iqfeedtest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := createConfig(0, "", false, false)
+	config.OutDirectory = t.TempDir()
+	config.Host = server.Host()
+	config.LookupPort = server.Port()
+
+	return server, config
+}
+
+func readTestFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func countGzipMembers(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	reader, err := gzip.NewReader(buffered)
+	assert.Nil(t, err)
+	members := 0
+
+	for {
+		reader.Multistream(false)
+		_, err = io.Copy(io.Discard, reader)
+		assert.Nil(t, err)
+		members++
+
+		if reader.Reset(buffered) == io.EOF {
+			return members
+		}
+	}
+}
+
+func listTestFiles(t *testing.T, directory string) []string {
+	entries, _ := os.ReadDir(directory)
+	var names []string
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestDownloadIntegration(t *testing.T) {
+	t.Run("eod bars", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+		}))
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, 2, result.Rows)
+		assert.Equal(t, int64(len(testEodFile)), result.Bytes)
+		assert.Equal(t, testEodFile, readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+		assert.Equal(t, "5.1", server.Protocol())
+		assert.Equal(t, "HDT", server.Requests()[0].Command)
+		assert.Equal(t, "SPY", server.Requests()[0].Symbol)
+		assert.Equal(t, "20190122", server.Requests()[0].BeginDate)
+		assert.Equal(t, "20190221", server.Requests()[0].EndDate)
+	})
+
+	t.Run("weekly bars of date range", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: []string{
+				"2019-01-18,24.5000,23.1000,23.4000,24.0000,151920,0,",
+				"2019-02-15,24.5000,23.1000,23.4000,24.0000,151920,0,",
+				"2019-02-22,24.6000,23.2000,23.5000,24.1000,141920,0,",
+			}},
+		}))
+		config.Command = "weekly"
+
+		result := DownloadWeekly(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, "HWX", server.Requests()[0].Command)
+		assert.Equal(t, "date,open,high,low,close,volume,oi\n2019-02-15,23.4000,24.5000,23.1000,24.0000,151920,0\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		_, config := startTestServer(t, iqfeedtest.Fixtures(nil))
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusNoData, result.Status)
+		assert.Nil(t, result.Err)
+		assert.Empty(t, listTestFiles(t, config.OutDirectory))
+	})
+
+	t.Run("malformed row closes connection", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: []string{"not a timestamp,23.8000,23.8000,23.8000,23.8000,13578,100,0,", "2019-02-26 12:22:00,23.8000,23.8000,23.8000,23.8000,13578,100,0,"}},
+			"QQQ": {Rows: []string{"2019-02-26 12:22:00,23.8000,23.8000,23.8000,23.8000,13578,100,0,"}},
+		}))
+		connection := &Conn{}
+
+		failed := DownloadMinute(context.Background(), "spy", connection, config)
+		succeeded := DownloadMinute(context.Background(), "qqq", connection, config)
+
+		assert.Equal(t, StatusFailed, failed.Status)
+		assert.NotNil(t, failed.Err)
+		assert.Equal(t, StatusSuccess, succeeded.Status)
+		assert.Equal(t, 1, succeeded.Rows)
+		assert.Equal(t, []string{"qqq.csv"}, listTestFiles(t, config.OutDirectory))
+		assert.Equal(t, 2, server.Connections())
+	})
+
+	t.Run("disconnect mid-stream", func(t *testing.T) {
+		_, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows, Disconnect: true},
+		}))
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusFailed, result.Status)
+		assert.Equal(t, errConnectionClosed, result.Err)
+		assert.Empty(t, listTestFiles(t, config.OutDirectory))
+	})
+
+	t.Run("retry after disconnect", func(t *testing.T) {
+		attempts := 0
+		server, config := startTestServer(t, func(request iqfeedtest.Request) iqfeedtest.Response {
+			attempts++
+			return iqfeedtest.Response{Rows: testEodRows, Disconnect: attempts == 1}
+		})
+		config.Retries = 1
+		config.RetryDelay = 0
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, DownloadEod)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, testEodFile, readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+		assert.Equal(t, 2, server.Connections())
+	})
+
+	t.Run("cancel slow response", func(t *testing.T) {
+		_, config := startTestServer(t, func(request iqfeedtest.Request) iqfeedtest.Response {
+			return iqfeedtest.Response{Rows: []string{testEodRows[0], testEodRows[0], testEodRows[0]}, Delay: time.Second}
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		result := DownloadEod(ctx, "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusCancelled, result.Status)
+		assert.Empty(t, listTestFiles(t, config.OutDirectory))
+	})
+
+	t.Run("reuse connection", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+			"QQQ": {Rows: testEodRows},
+		}))
+		connection := &Conn{}
+		defer connection.Close()
+
+		DownloadEod(context.Background(), "spy", connection, config)
+		DownloadEod(context.Background(), "qqq", connection, config)
+
+		assert.Equal(t, 2, len(server.Requests()))
+		assert.Equal(t, 1, server.Connections())
+	})
+
+	t.Run("microsecond ticks of confirmed protocol", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: []string{
+				"LH,2019-02-25 11:30:06.691523,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,1,25,",
+				"LH,2019-02-25 11:30:06.691524,23.8900,100,6814,23.8700,23.9700,7,O,25,3D87,2,25,",
+			}},
+		}))
+		config.Protocol = MicrosecondProtocol
+		config.MicrosecondTicks = true
+
+		result := DownloadTicks(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, "6.1", server.Protocol())
+		assert.Equal(t, "datetime,last,lastsize,totalsize,bid,ask,tickid,basis,market,cond,aggressor,daycode\n"+
+			"2019-02-25 11:30:06.691523,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,1,25\n"+
+			"2019-02-25 11:30:06.691524,23.8900,100,6814,23.8700,23.9700,7,O,25,3D87,2,25\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+	})
+
+	t.Run("update appends new rows", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+		}))
+		config.Command = "eod"
+		config.Update = true
+		path := filepath.Join(config.OutDirectory, "spy.csv")
+		_ = os.WriteFile(path, []byte(strings.Join(strings.SplitAfter(testEodFile, "\n")[:2], "")), 0644)
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, 1, result.Rows)
+		assert.Equal(t, testEodFile, readTestFile(t, path))
+		assert.Equal(t, "20190221", server.Requests()[0].BeginDate)
+	})
+
+	t.Run("chunks resume after disconnect", func(t *testing.T) {
+		attempts := 0
+		server, config := startTestServer(t, func(request iqfeedtest.Request) iqfeedtest.Response {
+			day := request.BeginDate[:8]
+			row := day[:4] + "-" + day[4:6] + "-" + day[6:] + " 09:31:00,23.8000,23.8000,23.8000,23.8000,13578,100,0,"
+
+			if day == "20190227" {
+				attempts++
+				return iqfeedtest.Response{Rows: []string{row}, Disconnect: attempts == 1}
+			}
+
+			return iqfeedtest.Response{Rows: []string{row}}
+		})
+		config.StartDate = "20190226"
+		config.EndDate = "20190227"
+		config.Chunk = ChunkDay
+		config.Retries = 1
+		config.RetryDelay = 0
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, DownloadMinute)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, 2, result.Rows)
+		assert.Equal(t, "datetime,open,high,low,close,volume\n"+
+			"2019-02-26 09:30:00,23.8000,23.8000,23.8000,23.8000,100\n"+
+			"2019-02-27 09:30:00,23.8000,23.8000,23.8000,23.8000,100\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+		assert.Equal(t, []string{"spy.csv"}, listTestFiles(t, config.OutDirectory))
+		assert.Equal(t, 3, len(server.Requests()))
+	})
+
+	t.Run("gzip chunks without empty members", func(t *testing.T) {
+		_, config := startTestServer(t, func(request iqfeedtest.Request) iqfeedtest.Response {
+			if request.BeginDate[:8] == "20190227" {
+				return iqfeedtest.Response{Error: "!NO_DATA!"}
+			}
+
+			return iqfeedtest.Response{Rows: []string{"2019-02-26 09:31:00,23.8000,23.8000,23.8000,23.8000,13578,100,0,"}}
+		})
+		config.StartDate = "20190226"
+		config.EndDate = "20190227"
+		config.Chunk = ChunkDay
+		config.Gzip = true
+
+		result := DownloadMinute(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, 1, countGzipMembers(t, filepath.Join(config.OutDirectory, "spy.csv.gz")))
+	})
+}
+
+func TestRecordReplayIntegration(t *testing.T) {
+	t.Run("replay recorded session", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: []string{testValidIqfeedMinuteBar[4:]}},
+		}))
+		config.RecordDirectory = t.TempDir()
+
+		recorded := DownloadMinute(context.Background(), "spy", &Conn{}, config)
+		server.Close()
+		sent := readTestFile(t, filepath.Join(config.RecordDirectory, "SPY.sent"))
+		received := readTestFile(t, filepath.Join(config.RecordDirectory, "SPY.received"))
+
+		replayConfig := *config
+		replayConfig.RecordDirectory = ""
+		replayConfig.ReplayDirectory = config.RecordDirectory
+		replayConfig.OutDirectory = t.TempDir()
+		replayConfig.TimeZone = "UTC"
+		replayed := DownloadWithRetry(context.Background(), "spy", &Conn{}, &replayConfig, DownloadMinute)
+
+		assert.Equal(t, StatusSuccess, recorded.Status)
+		assert.Equal(t, StatusSuccess, replayed.Status)
+		assert.Regexp(t, `^S,SET PROTOCOL,5\.1\r\nHIT,SPY,60,20190122,20190221,,,,1,\d+\r\n$`, sent)
+		assert.Regexp(t, `^S,CURRENT PROTOCOL,5\.1\r\n(\d+),2019-02-26 12:22:00,.*\r\n\d+,!ENDMSG!,\r\n$`, received)
+		assert.Equal(t, "datetime,open,high,low,close,volume\n2019-02-26 17:21:00,23.8000,23.8000,23.8000,23.8000,100\n",
+			readTestFile(t, filepath.Join(replayConfig.OutDirectory, "spy.csv")))
+	})
+
+	t.Run("replay recording of reused connection", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: []string{testValidIqfeedMinuteBar[4:]}},
+			"QQQ": {Rows: []string{testValidIqfeedMinuteBar[4:]}},
+		}))
+		config.RecordDirectory = t.TempDir()
+		connection := &Conn{}
+
+		DownloadMinute(context.Background(), "spy", connection, config)
+		recorded := DownloadMinute(context.Background(), "qqq", connection, config)
+		server.Close()
+		sent := readTestFile(t, filepath.Join(config.RecordDirectory, "QQQ.sent"))
+		received := readTestFile(t, filepath.Join(config.RecordDirectory, "QQQ.received"))
+
+		replayConfig := *config
+		replayConfig.RecordDirectory = ""
+		replayConfig.ReplayDirectory = config.RecordDirectory
+		replayConfig.OutDirectory = t.TempDir()
+		replayed := DownloadMinute(context.Background(), "qqq", &Conn{}, &replayConfig)
+
+		assert.Equal(t, StatusSuccess, recorded.Status)
+		assert.Equal(t, StatusSuccess, replayed.Status)
+		assert.Equal(t, 1, server.Connections())
+		assert.Regexp(t, `^S,SET PROTOCOL,5\.1\r\nHIT,QQQ,`, sent)
+		assert.Regexp(t, `^S,CURRENT PROTOCOL,5\.1\r\n\d+,2019-02-26 12:22:00,`, received)
+	})
+
+	t.Run("replay disconnected session", func(t *testing.T) {
+		directory := t.TempDir()
+		_ = os.WriteFile(filepath.Join(directory, "SPY.received"), []byte("7,2019-02-21,24.0600,23.8038,23.8700,24.0000,29183,0,\r\n"), 0644)
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.ReplayDirectory = directory
+		config.Retries = 3
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, DownloadEod)
+
+		assert.Equal(t, StatusFailed, result.Status)
+		assert.Equal(t, errConnectionClosed, result.Err)
+		assert.Empty(t, listTestFiles(t, config.OutDirectory))
+	})
+
+	t.Run("missing recording", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.ReplayDirectory = t.TempDir()
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusFailed, result.Status)
+		assert.True(t, os.IsNotExist(result.Err))
+	})
+}
+
+func TestClientIntegration(t *testing.T) {
+	t.Run("eod bars", func(t *testing.T) {
+		server, _ := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+		}))
+		client := &Client{Host: server.Host(), LookupPort: server.Port()}
+
+		bars, err := client.EOD(context.Background(), "SPY", time.Date(2019, 2, 21, 0, 0, 0, 0, time.UTC), time.Time{})
+		assert.Nil(t, err)
+		defer bars.Close()
+
+		var closes []float64
+		for bars.Next() {
+			closes = append(closes, bars.Bar().Close)
+		}
+
+		assert.Nil(t, bars.Err())
+		assert.Equal(t, []float64{24.0, 24.05}, closes)
+		assert.Equal(t, NewProtocol, server.Protocol())
+		assert.Equal(t, "20190221", server.Requests()[0].BeginDate)
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		server, _ := startTestServer(t, iqfeedtest.Fixtures(nil))
+		client := &Client{Host: server.Host(), LookupPort: server.Port()}
+
+		ticks, err := client.Ticks(context.Background(), "SPY", time.Time{}, time.Time{})
+		assert.Nil(t, err)
+		defer ticks.Close()
+
+		assert.False(t, ticks.Next())
+		assert.Nil(t, ticks.Err())
+	})
+}
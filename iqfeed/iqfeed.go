@@ -0,0 +1,885 @@
+// Package iqfeed downloads historical market data from the IQFeed historical lookup port,
+// either as typed bars and ticks with a Client or into CSV, TSV or Parquet files with the Download functions.
+package iqfeed
+
+import (
+	"4d63.com/tz"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+)
+
+type rowMapper func(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error)
+type requestFactory func(symbol string, requestId string, config *Config) string
+
+const (
+	errorMessage               = "E"
+	stateMessage               = "S"
+	endMessage                 = "!ENDMSG!"
+	historyMessage             = "LH"
+	secondTimestampFormat      = "2006-01-02 15:04:05"
+	millisecondTimestampFormat = "2006-01-02 15:04:05.000"
+	microsecondTimestampFormat = "2006-01-02 15:04:05.000000"
+	csvSeparator               = ","
+	tsvSeparator               = "\t"
+	bufferSize                 = 4 * 1024 * 1024
+	intervalHeader             = "datetime,open,high,low,close,volume"
+)
+
+const (
+	DefaultProtocol     = "5.1"
+	NewProtocol         = "6.0"
+	MicrosecondProtocol = "6.1"
+)
+
+// Config holds the options of the package functions. The connection and output options apply to every function,
+// the other groups list the functions that use them and are ignored by the rest.
+type Config struct {
+	// Connection options of every IQFeed request
+	Protocol        string
+	Host            string
+	LookupPort      int
+	Level1Port      int
+	DerivativePort  int
+	Level2Port      int
+	RecordDirectory string
+	ReplayDirectory string
+
+	// Output options of every written file, DetailedLogging logs every written row
+	OutDirectory    string
+	TimeZone        string
+	TSV             bool
+	Gzip            bool
+	Format          string
+	EndTimestamp    bool
+	TimeFormat      string
+	DetailedLogging bool
+
+	// Request options of the Download functions and ResampleTicks. Command is the name of the data type, such as
+	// eod, minute or tick, and selects the validation, update, chunk and session rules of the download.
+	Command        string
+	StartDate      string
+	EndDate        string
+	Days           int
+	MaxPoints      int
+	IntervalType   string
+	IntervalLength int
+	UseLabels      bool
+	Session        string
+	Update         bool
+	Chunk          string
+
+	// Retry options of DownloadWithRetry, and the reconnects of Stream, StreamBars and StreamDepth, which are
+	// unlimited for negative ReconnectLimit. RetryDelay is the first delay of both.
+	Retries        int
+	ReconnectLimit int
+	RetryDelay     time.Duration
+
+	// Depth options of StreamDepth
+	MarketMakers     []string
+	SnapshotInterval time.Duration
+
+	// Adjustment options of DownloadEod
+	Adjust       string
+	AdjustFactor bool
+
+	// Continuous futures options of FuturesContracts and BuildContinuous
+	ContractMonths string
+	Roll           string
+	RollDays       int
+	RollAdjustment string
+
+	// Resample options of ResampleTicks
+	InDirectory string
+	BarType     string
+	BarSize     float64
+
+	// Tick options of DownloadTicks
+	MicrosecondTicks bool
+}
+
+// DownloadFunc downloads a symbol into a file in the output directory using the connection,
+// a cancelled context aborts the download and removes the partial file
+type DownloadFunc func(context.Context, string, *Conn, *Config) DownloadResult
+
+var errConnectionClosed = errors.New("connection closed by IQFeed")
+
+// iqfeedError is an error message returned by IQFeed for a request
+type iqfeedError struct {
+	message string
+}
+
+func (e *iqfeedError) Error() string {
+	return fmt.Sprintf("iqfeed error: %s", e.message)
+}
+
+var (
+	previousRequestId int64 = 0
+	sourceLocation    *time.Location
+)
+
+func init() {
+	location, err := tz.LoadLocation("America/New_York")
+
+	if err != nil {
+		log.Fatal("Could not load source time zone: America/New_York")
+	}
+
+	sourceLocation = location
+}
+
+// DownloadEod downloads daily bars
+func DownloadEod(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+	header := "date,open,high,low,close,volume,oi"
+
+	// Corporate actions are only requested for files that are downloaded
+	if config.Adjust == "" || fileExists(filepath.Join(config.OutDirectory, getFilename(symbol, config))) {
+		return download(ctx, symbol, rangeOrRecent(createEodRequest, createRecentEodRequest, config), mapEodBar, header, connection, config)
+	}
+
+	adjustment, err := loadAdjustment(ctx, symbol, config)
+
+	if err != nil {
+		log.WithField("symbol", strings.ToUpper(symbol)).WithError(err).Error("Could not load corporate actions")
+		result := DownloadResult{Symbol: strings.ToUpper(symbol)}.failed(err)
+
+		if ctx.Err() != nil {
+			result = result.cancelled(ctx.Err())
+		}
+
+		return result
+	}
+
+	if config.AdjustFactor {
+		header += ",adj_factor"
+	}
+
+	log.WithFields(log.Fields{"symbol": strings.ToUpper(symbol), "actions": len(adjustment.actions)}).Debug("Adjusting prices")
+	return download(ctx, symbol, rangeOrRecent(createEodRequest, createRecentEodRequest, config), adjustment.mapEodBar, header, connection, config)
+}
+
+// DownloadWeekly downloads weekly bars
+func DownloadWeekly(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+	header := "date,open,high,low,close,volume,oi"
+	return download(ctx, symbol, createWeeklyRequest, mapPeriodBar, header, connection, config)
+}
+
+// DownloadMonthly downloads monthly bars
+func DownloadMonthly(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+	header := "date,open,high,low,close,volume,oi"
+	return download(ctx, symbol, createMonthlyRequest, mapPeriodBar, header, connection, config)
+}
+
+// DownloadMinute downloads minute bars
+func DownloadMinute(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+	return download(ctx, symbol, rangeOrRecent(createMinuteRequest, createRecentMinuteRequest, config), mapMinuteBar, intervalHeader, connection, config)
+}
+
+// DownloadTicks downloads ticks
+func DownloadTicks(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+	header := "datetime,last,lastsize,totalsize,bid,ask,tickid,basis,market,cond"
+
+	if config.MicrosecondTicks {
+		header += ",aggressor,daycode"
+	}
+
+	return download(ctx, symbol, rangeOrRecent(createTickRequest, createRecentTickRequest, config), mapTick, header, connection, config)
+}
+
+// DownloadInterval downloads seconds, volume or ticks interval bars
+func DownloadInterval(ctx context.Context, symbol string, connection *Conn, config *Config) DownloadResult {
+	return download(ctx, symbol, rangeOrRecent(createIntervalRequest, createRecentIntervalRequest, config), mapIntervalBar, intervalHeader, connection, config)
+}
+
+func download(ctx context.Context, symbol string, createRequest requestFactory, rowMapper rowMapper, csvHeader string, connection *Conn, config *Config) (result DownloadResult) {
+	successful := false
+	started := time.Now()
+	result = DownloadResult{Symbol: strings.ToUpper(symbol)}
+
+	// Report downloads aborted by a cancelled context as cancelled instead of failed
+	defer func() {
+		if result.Status == StatusFailed && ctx.Err() != nil {
+			result = result.cancelled(ctx.Err())
+		}
+	}()
+
+	// Setup log context
+	logCtx := log.WithFields(log.Fields{
+		"symbol": strings.ToUpper(symbol),
+	})
+
+	// Get target time zone
+	targetLocation, err := LoadLocation(config.TimeZone)
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not load target time zone")
+		return result.failed(err)
+	}
+
+	// Skip the rows outside the session, IQFeed filters by its own bar timestamps
+	if config.Session != "" {
+		filter, err := parseSession(config.Session)
+
+		if err != nil {
+			logCtx.WithError(err).Error("Could not parse session")
+			return result.failed(err)
+		}
+
+		rowMapper = filterSession(rowMapper, filter)
+	}
+
+	// Get output filename
+	filename := getFilename(symbol, config)
+	path := filepath.Join(config.OutDirectory, filename)
+
+	// Check if output file already exists, in update mode continue from its last timestamp
+	appending := false
+	var lastTimestamp time.Time
+
+	if fileExists(path) {
+		if !config.Update {
+			logCtx.Info("Already downloaded")
+			result.Status = StatusSkipped
+			return result
+		}
+
+		lastTimestamp, err = readLastTimestamp(path, targetLocation, config)
+
+		if err != nil {
+			logCtx.WithError(err).Error("Could not read last timestamp of existing file")
+			return result.failed(err)
+		}
+
+		appending = true
+
+		if !lastTimestamp.IsZero() {
+			config = updateConfig(lastTimestamp, config)
+			logCtx = logCtx.WithField("after", lastTimestamp.Format(secondTimestampFormat))
+		}
+	}
+
+	// Split the date range into chunks, a retry resumes after the last chunk in the checkpoint
+	chunks, err := planChunks(config, time.Now())
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not split date range into chunks")
+		return result.failed(err)
+	}
+
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	checkpointPath := fmt.Sprintf("%s.chunk", path)
+	checkpointing := config.Chunk != "" && config.Format != ParquetFormat
+	progress := newCheckpoint(config)
+	resuming := false
+
+	if checkpointing && fileExists(tmpPath) {
+		progress, resuming = readCheckpoint(checkpointPath, config)
+
+		if !resuming {
+			progress = newCheckpoint(config)
+		}
+	}
+
+	// Replay a recording instead of connecting to IQFeed, or record the raw bytes of the requests
+	if config.ReplayDirectory != "" {
+		connection, err = openReplay(config.ReplayDirectory, symbol)
+
+		if err != nil {
+			logCtx.WithError(err).Error("Could not open recording")
+			return result.failed(err)
+		}
+
+		defer connection.Close()
+	} else if config.RecordDirectory != "" {
+		stopRecording, err := connection.record(config.RecordDirectory, symbol)
+
+		if err != nil {
+			logCtx.WithError(err).Error("Could not create recording")
+			return result.failed(err)
+		}
+
+		defer stopRecording()
+	}
+
+	// Connect to IQFeed Historical socket unless already connected
+	err = connection.connect(ctx, config)
+
+	if err != nil {
+		logCtx.WithError(err).WithField("address", lookupAddress(config)).Error("Could not connect to IQFeed")
+		return result.failed(err)
+	}
+
+	stopWatch := connection.watch(ctx)
+	defer stopWatch()
+
+	if resuming {
+		logCtx.WithField("completed", progress.Completed).Info("Resuming")
+	} else {
+		logCtx.Info("Downloading")
+	}
+
+	// Setup write pipeline
+	var of *os.File
+
+	if resuming {
+		of, err = openCheckpointFile(tmpPath, progress.Size)
+	} else {
+		of, err = os.Create(tmpPath)
+	}
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not create output file")
+		return result.failed(err)
+	}
+
+	// Copy the existing file first when appending, gzip handles the appended rows as a new member
+	if appending && !resuming {
+		err = copyFile(path, of)
+
+		if err != nil {
+			_ = of.Close()
+			_ = os.Remove(tmpPath)
+			logCtx.WithError(err).Error("Could not copy existing file")
+			return result.failed(err)
+		}
+	}
+
+	counter := &countingWriter{writer: of, count: progress.Bytes}
+	var writer outputWriter
+
+	if config.Format == ParquetFormat {
+		writer, err = newParquetWriter(csvHeader, counter, targetLocation, config)
+	} else {
+		writer = newTextWriter(counter, config)
+	}
+
+	if err != nil {
+		_ = of.Close()
+		_ = os.Remove(tmpPath)
+		logCtx.WithError(err).Error("Could not create output writer")
+		return result.failed(err)
+	}
+
+	// Defer closing output file and removing the file if an error occurred,
+	// the file and checkpoint of a failed chunked download are kept for the retry
+	defer func() {
+		_ = of.Close()
+
+		if successful {
+			err = os.Rename(tmpPath, path)
+			if err != nil {
+				logCtx.WithError(err).Error("Rename temporary file to output file error")
+				result = result.failed(err)
+			}
+		}
+
+		keepCheckpoint := !successful && result.Status == StatusFailed && ctx.Err() == nil && fileExists(checkpointPath)
+
+		if !successful && !keepCheckpoint && fileExists(tmpPath) {
+			err = os.Remove(tmpPath)
+			if err != nil {
+				logCtx.WithError(err).Error("Delete temporary download output file error")
+			}
+		}
+
+		if !keepCheckpoint && fileExists(checkpointPath) {
+			_ = os.Remove(checkpointPath)
+		}
+
+		if successful {
+			result.Bytes = counter.count
+		}
+	}()
+
+	// Write header
+	if !appending && !resuming {
+		err = writer.writeHeader(csvHeader)
+
+		if err != nil {
+			logCtx.WithError(err).Error("Add header error")
+			return result.failed(err)
+		}
+	}
+
+	// Process chunks
+	rowCount := progress.Rows
+	noData := true
+
+	for _, chunk := range chunks {
+		if resuming && chunk.end <= progress.Completed {
+			continue
+		}
+
+		chunkConfig := *config
+		chunkConfig.StartDate = chunk.start
+		chunkConfig.EndDate = chunk.end
+
+		rows, err := downloadRequest(ctx, symbol, createRequest, rowMapper, connection, writer, targetLocation, lastTimestamp, &chunkConfig, logCtx)
+
+		if isNoData(err) {
+			logCtx.WithFields(log.Fields{"start": chunk.start, "end": chunk.end}).Debug("No data in chunk")
+		} else if err != nil {
+			return result.failed(err)
+		} else {
+			noData = false
+		}
+
+		rowCount += rows
+
+		if checkpointing {
+			err = writer.flush()
+
+			if err == nil {
+				progress.Completed = chunk.end
+				progress.Rows = rowCount
+				progress.Bytes = counter.count
+				err = saveCheckpoint(checkpointPath, of, progress)
+			}
+
+			if err != nil {
+				logCtx.WithError(err).Error("Checkpoint error")
+				return result.failed(err)
+			}
+		}
+	}
+
+	if noData && rowCount == 0 {
+		logCtx.Info("No data")
+		result.Status = StatusNoData
+		result.Duration = time.Since(started)
+		return result
+	}
+
+	err = writer.flush()
+
+	if err != nil {
+		logCtx.WithError(err).Error("Flush output file error")
+		return result.failed(err)
+	}
+
+	result.Status = StatusSuccess
+	result.Duration = time.Since(started)
+
+	if appending && rowCount == 0 {
+		logCtx.Info("Already up to date")
+		return result
+	}
+
+	successful = true
+	result.Rows = rowCount
+
+	logCtx.WithFields(log.Fields{
+		"symbol":   strings.ToUpper(symbol),
+		"duration": fmt.Sprintf("%dms", result.Duration.Milliseconds()),
+		"rows":     rowCount}).Info("Completed")
+
+	return result
+}
+
+// downloadRequest sends a request and writes its rows until the end message, returning the number of written rows,
+// the connection is closed unless all rows of the request are read, to not mix them up with the next request
+func downloadRequest(ctx context.Context, symbol string, createRequest requestFactory, rowMapper rowMapper, connection *Conn, writer outputWriter,
+	targetLocation *time.Location, lastTimestamp time.Time, config *Config, logCtx log.Interface) (rowCount int, err error) {
+	requestCompleted := false
+
+	defer func() {
+		if !requestCompleted {
+			_ = connection.Close()
+		}
+	}()
+
+	// Send request
+	requestId := fmt.Sprintf("%d", atomic.AddInt64(&previousRequestId, 1))
+	request := createRequest(symbol, requestId, config)
+	logCtx.Debug(request)
+	err = connection.send(requestId, request)
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not send request")
+		return 0, err
+	}
+
+	// Map the rows in the format of the protocol confirmed by IQFeed, which can differ from the requested protocol
+	mapConfig := connection.protocolConfig(config)
+
+	// Process rows
+	for {
+		iqfeedRow, err := connection.read()
+
+		if err != nil && ctx.Err() != nil {
+			logCtx.Info("Cancelled")
+			return rowCount, ctx.Err()
+		} else if err == io.EOF {
+			logCtx.Error("Connection closed by IQFeed")
+			return rowCount, errConnectionClosed
+		} else if err != nil {
+			logCtx.WithError(err).Error("Read row error")
+			return rowCount, err
+		}
+
+		if config.DetailedLogging {
+			logCtx.Debug(strings.Join(iqfeedRow, ","))
+		}
+
+		if len(iqfeedRow) > 0 && iqfeedRow[0] == stateMessage {
+			mapConfig = connection.protocolConfig(config)
+		}
+
+		mappedRow, err := mapRow(iqfeedRow, requestId, rowMapper, targetLocation, mapConfig)
+
+		if err == io.EOF {
+			requestCompleted = true
+			return rowCount, nil
+		} else if _, ok := err.(*iqfeedError); ok {
+			drainErr := connection.drain(requestId)
+			requestCompleted = drainErr == nil
+
+			if isNoData(err) && drainErr != nil {
+				logCtx.WithError(drainErr).Error("Read row error")
+				return rowCount, drainErr
+			} else if !isNoData(err) {
+				logCtx.WithError(err).Error("Map row error")
+			}
+
+			return rowCount, err
+		} else if err != nil {
+			logCtx.WithError(err).Error("Map row error")
+			return rowCount, err
+		} else if mappedRow == "" {
+			continue
+		}
+
+		if !lastTimestamp.IsZero() {
+			timestamp, err := parseRowTimestamp(mappedRow, targetLocation, config)
+
+			if err != nil {
+				logCtx.WithError(err).Error("Parse row timestamp error")
+				return rowCount, err
+			} else if !timestamp.After(lastTimestamp) {
+				continue
+			}
+		}
+
+		err = writer.writeRow(mappedRow)
+
+		if err != nil {
+			logCtx.WithError(err).Error("Write output row error")
+			return rowCount, err
+		}
+
+		rowCount++
+	}
+}
+
+func getFilename(symbol string, config *Config) string {
+	filename := symbol
+
+	if config.Format == ParquetFormat {
+		return fmt.Sprintf("%s.parquet", filename)
+	} else if config.TSV {
+		filename = fmt.Sprintf("%s.tsv", filename)
+	} else {
+		filename = fmt.Sprintf("%s.csv", filename)
+	}
+
+	if config.Gzip {
+		filename = fmt.Sprintf("%s.gz", filename)
+	}
+
+	return filename
+}
+
+// LoadLocation loads a time zone from an IANA name or one of the abbreviations ET, CT, PT and UTC
+func LoadLocation(timeZone string) (*time.Location, error) {
+	abbreviations := map[string]string{
+		"UTC": "UTC", // Handle lower case utc -> UTC
+		"":    "America/New_York",
+		"ET":  "America/New_York",
+		"EST": "America/New_York",
+		"CT":  "America/Chicago",
+		"CST": "America/Chicago",
+		"PT":  "America/Los_Angeles",
+		"PST": "America/Los_Angeles",
+	}
+
+	if timeZoneFromAbbreviation, found := abbreviations[strings.ToUpper(timeZone)]; found {
+		timeZone = timeZoneFromAbbreviation
+	}
+
+	return tz.LoadLocation(timeZone)
+}
+
+// checkRow returns true for data rows of the request, false for state messages,
+// io.EOF for the end message and an iqfeedError for error messages
+func checkRow(iqfeedRow []string, requestId string) (bool, error) {
+	if len(iqfeedRow) == 0 {
+		return false, fmt.Errorf("empty row")
+	}
+	if iqfeedRow[0] == stateMessage {
+		return false, nil
+	}
+	if iqfeedRow[0] != requestId {
+		return false, fmt.Errorf("incorrect request id")
+	}
+	if len(iqfeedRow) < 2 {
+		return false, fmt.Errorf("too few columns")
+	}
+	if iqfeedRow[1] == endMessage {
+		return false, io.EOF
+	}
+	if iqfeedRow[1] == errorMessage && len(iqfeedRow) >= 3 {
+		return false, &iqfeedError{message: iqfeedRow[2]}
+	}
+
+	return true, nil
+}
+
+func mapRow(iqfeedRow []string, requestId string, rowMapper rowMapper, targetLocation *time.Location, config *Config) (outputRow string, err error) {
+	data, err := checkRow(iqfeedRow, requestId)
+
+	if !data {
+		return "", err
+	}
+
+	// Protocol 6.1 and later send the LH message id after the request id of history rows
+	if iqfeedRow[1] == historyMessage {
+		iqfeedRow = append([]string{iqfeedRow[0]}, iqfeedRow[2:]...)
+	}
+
+	outputRow, err = rowMapper(iqfeedRow, targetLocation, config)
+
+	if err != nil && err.Error() == "too few columns" {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("map row error: %s", iqfeedRow)
+	}
+
+	if config.TSV {
+		outputRow = strings.Replace(outputRow, csvSeparator, tsvSeparator, -1)
+	}
+
+	return outputRow, nil
+}
+
+// EOD
+
+func createEodRequest(symbol string, requestId string, config *Config) string {
+	// HDT,[Symbol],[BeginDate],[EndDate],[MaxDatapoints],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+	return fmt.Sprintf("HDT,%s,%s,%s,,1,%s", strings.ToUpper(symbol), config.StartDate, config.EndDate, requestId)
+}
+
+func mapEodBar(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error) {
+	if len(iqfeedRow) < 8 {
+		return "", fmt.Errorf("too few columns")
+	}
+
+	date, err := formatDate(iqfeedRow[1], tz, config)
+
+	if err != nil {
+		return "", err
+	}
+
+	// Columns from IQFeed (unorthodox ordering of OHLC with High first):
+	// 1          2     3    4     5      6       7
+	// timestamp, high, low, open, close, volume, openInterest
+
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s",
+			date,          // date
+			iqfeedRow[4],  // open
+			iqfeedRow[2],  // high
+			iqfeedRow[3],  // low
+			iqfeedRow[5],  // close
+			iqfeedRow[6],  // volume
+			iqfeedRow[7]), // open interest
+		nil
+}
+
+// Weekly and monthly bars
+
+func createWeeklyRequest(symbol string, requestId string, config *Config) string {
+	// HWX,[Symbol],[MaxDatapoints],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+	return fmt.Sprintf("HWX,%s,%s,1,%s", strings.ToUpper(symbol), maxDatapoints(config), requestId)
+}
+
+func createMonthlyRequest(symbol string, requestId string, config *Config) string {
+	// HMX,[Symbol],[MaxDatapoints],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+	return fmt.Sprintf("HMX,%s,%s,1,%s", strings.ToUpper(symbol), maxDatapoints(config), requestId)
+}
+
+func mapPeriodBar(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error) {
+	if len(iqfeedRow) < 8 {
+		return "", fmt.Errorf("too few columns")
+	}
+
+	// NOTE: Weekly and monthly requests do not support a date range,
+	//       so the start and end date filters are applied to the returned bars
+	date := strings.Replace(iqfeedRow[1], "-", "", -1)
+
+	if len(date) > 8 {
+		date = date[:8]
+	}
+
+	if (config.StartDate != "" && date < config.StartDate) || (config.EndDate != "" && date > config.EndDate) {
+		return "", nil
+	}
+
+	return mapEodBar(iqfeedRow, tz, config)
+}
+
+// Minute bars
+
+func createMinuteRequest(symbol string, requestId string, config *Config) string {
+	// HIT,[Symbol],[Interval],[BeginDate BeginTime],[EndDate EndTime],[MaxDatapoints],[BeginFilterTime],[EndFilterTime],[DataDirection],[RequestID],[DatapointsPerSend],[IntervalType],[LabelAtBeginning]<CR><LF>
+	beginFilter, endFilter := sessionFilterTimes(config)
+	return fmt.Sprintf("HIT,%s,60,%s,%s,,%s,%s,1,%s", strings.ToUpper(symbol), config.StartDate, config.EndDate, beginFilter, endFilter, requestId)
+}
+
+func mapMinuteBar(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error) {
+	if len(iqfeedRow) < 7 {
+		return "", fmt.Errorf("too few columns")
+	}
+
+	// NOTE: In version 5 of the IQFeed protocol minute bars are timestamped at the end of the bar
+	//       and have to be adjusted -1 minute to be at the start of the bar (same as EOD bars)
+	timestamp, err := time.ParseInLocation(secondTimestampFormat, iqfeedRow[1], sourceLocation)
+
+	if err != nil {
+		return "", fmt.Errorf("could not parse minute bar timestamp: %s", err)
+	}
+
+	if !config.EndTimestamp {
+		timestamp = timestamp.Add(-time.Minute * 1)
+	}
+
+	timestamp = timestamp.In(tz)
+
+	// Columns from IQFeed (unorthodox ordering of OHLC with High first):
+	// 1          2     3    4     5      6            7             8
+	// timestamp, high, low, open, close, totalVolume, periodVolume, numberOfTrades
+
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s",
+			formatTimestamp(timestamp, secondTimestampFormat, config), // datetime
+			iqfeedRow[4],  // open
+			iqfeedRow[2],  // high
+			iqfeedRow[3],  // low
+			iqfeedRow[5],  // close
+			iqfeedRow[7]), // volume
+		nil
+}
+
+// Interval bars
+
+func createIntervalRequest(symbol string, requestId string, config *Config) string {
+	// HIT,[Symbol],[Interval],[BeginDate BeginTime],[EndDate EndTime],[MaxDatapoints],[BeginFilterTime],[EndFilterTime],[DataDirection],[RequestID],[DatapointsPerSend],[IntervalType],[LabelAtBeginning]<CR><LF>
+	label := intervalLabel(config)
+	beginFilter, endFilter := sessionFilterTimes(config)
+	return fmt.Sprintf("HIT,%s,%d,%s,%s,,%s,%s,1,%s,,%s%s", strings.ToUpper(symbol), config.IntervalLength, config.StartDate, config.EndDate,
+		beginFilter, endFilter, requestId, config.IntervalType, label)
+}
+
+// intervalLabel returns the LabelAtBeginning request field with its separator, empty without labels
+func intervalLabel(config *Config) string {
+	if config.UseLabels && config.EndTimestamp {
+		return ",0"
+	} else if config.UseLabels && !config.EndTimestamp {
+		return ",1"
+	}
+
+	return ""
+}
+
+func mapIntervalBar(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error) {
+	if len(iqfeedRow) < 7 {
+		return "", fmt.Errorf("too few columns")
+	}
+
+	timestamp, err := time.ParseInLocation(secondTimestampFormat, iqfeedRow[1], sourceLocation)
+
+	if err != nil {
+		return "", fmt.Errorf("could not parse interval bar timestamp: %s", err)
+	}
+
+	timestamp = timestamp.In(tz)
+
+	// Columns from IQFeed (unorthodox ordering of OHLC with High first):
+	// 1          2     3    4     5      6            7             8
+	// timestamp, high, low, open, close, totalVolume, periodVolume, numberOfTrades
+
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s",
+			formatTimestamp(timestamp, secondTimestampFormat, config), // datetime
+			iqfeedRow[4],  // open
+			iqfeedRow[2],  // high
+			iqfeedRow[3],  // low
+			iqfeedRow[5],  // close
+			iqfeedRow[7]), // volume
+		nil
+}
+
+// Ticks
+
+func createTickRequest(symbol string, requestId string, config *Config) string {
+	// HTT,[Symbol],[BeginDate BeginTime],[EndDate EndTime],[MaxDatapoints],[BeginFilterTime],[EndFilterTime],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+	beginFilter, endFilter := sessionFilterTimes(config)
+	return fmt.Sprintf("HTT,%s,%s,%s,,%s,%s,1,%s", strings.ToUpper(symbol), config.StartDate, config.EndDate, beginFilter, endFilter, requestId)
+}
+
+func mapTick(iqfeedRow []string, tz *time.Location, config *Config) (outputRow string, err error) {
+	if len(iqfeedRow) < 11 {
+		return "", fmt.Errorf("too few columns")
+	}
+
+	// Protocol 6.1 and later send microsecond timestamps, which are kept to not merge distinct trades
+	microseconds := protocolAtLeast(config.Protocol, MicrosecondProtocol)
+	layout := millisecondTimestampFormat
+
+	if microseconds {
+		layout = microsecondTimestampFormat
+	}
+
+	timestamp, err := time.ParseInLocation(layout, iqfeedRow[1], sourceLocation)
+
+	if err != nil {
+		return "", fmt.Errorf("could not parse tick timestamp: %s", err)
+	}
+
+	timestamp = timestamp.In(tz)
+
+	columns := []string{
+		formatTimestamp(timestamp, layout, config), // datetime
+		iqfeedRow[2],  // last
+		iqfeedRow[3],  // last size
+		iqfeedRow[4],  // total size
+		iqfeedRow[5],  // bid
+		iqfeedRow[6],  // ask
+		iqfeedRow[7],  // tick id
+		iqfeedRow[8],  // basis
+		iqfeedRow[9],  // market
+		iqfeedRow[10], // conditions
+	}
+
+	// The trade aggressor and day code are empty when IQFeed confirmed an older protocol
+	if config.MicrosecondTicks {
+		aggressor, dayCode := "", ""
+
+		if microseconds && len(iqfeedRow) >= 13 {
+			aggressor, dayCode = iqfeedRow[11], iqfeedRow[12]
+		}
+
+		columns = append(columns, aggressor, dayCode)
+	}
+
+	return strings.Join(columns, csvSeparator), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -1,4 +1,4 @@
-package main
+package iqfeed
 
 import (
 	"4d63.com/tz"
@@ -18,11 +18,14 @@ var (
 	testNoDataMessage                = "999,E,!NO_DATA!,,"
 	testValidIqfeedEodBar            = "999,2019-02-21,24.0600,23.8038,23.8700,24.0000,29183,0,"
 	testTooFewColumnsIqfeedEodBar    = "999,2019-02-21,24.0600,23.8038,23.8700,24.0000,29183"
+	testValidIqfeedWeeklyBar         = "999,2019-02-15,24.5000,23.1000,23.4000,24.0000,151920,0,"
+	testEarlyIqfeedWeeklyBar         = "999,2019-01-18,24.5000,23.1000,23.4000,24.0000,151920,0,"
 	testValidIqfeedMinuteBar         = "999,2019-02-26 12:22:00,23.8000,23.8000,23.8000,23.8000,13578,100,0,"
 	testTooFewColumnsIqfeedMinuteBar = "999,2019-02-26 12:22:00,23.8000,23.8000,23.8000,23.8000"
 	testValidIqfeedTick              = "999,2019-02-25 11:30:06.691,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,"
 	testTooFewColumnsIqfeedTick      = "999,2019-02-25 11:30:06.691,23.8800,12,6714,23.8700,23.9700,6,O,25"
 	testIncorrectRequestIdIqfeedTick = "111,2019-02-25 11:30:06.691,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,"
+	testMicrosecondIqfeedTick        = "999,LH,2019-02-25 11:30:06.691523,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,1,25,"
 	et                               *time.Location
 )
 
@@ -55,6 +58,17 @@ func TestMapRow(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("history message id of protocol 6.1", func(t *testing.T) {
+		columns := strings.Split(testMicrosecondIqfeedTick, ",")
+		config := createConfig(0, "", false, false)
+		config.Protocol = MicrosecondProtocol
+
+		mappedRow, err := mapRow(columns, testRequestId, mapTick, et, config)
+
+		assert.Equal(t, "2019-02-25 11:30:06.691523,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87", mappedRow)
+		assert.Nil(t, err)
+	})
+
 	t.Run("no columns", func(t *testing.T) {
 		var columns []string
 
@@ -100,6 +114,30 @@ func TestMapRow(t *testing.T) {
 		assert.Errorf(t, err, "iqfeed error: !NO DATA!")
 	})
 
+	t.Run("microsecond tick with aggressor and day code", func(t *testing.T) {
+		columns := strings.Split(testMicrosecondIqfeedTick, ",")
+		columns = append(columns[:1], columns[2:]...)
+		config := createConfig(0, "", false, false)
+		config.Protocol = MicrosecondProtocol
+		config.MicrosecondTicks = true
+
+		mappedRow, err := mapTick(columns, et, config)
+
+		assert.Equal(t, "2019-02-25 11:30:06.691523,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,1,25", mappedRow)
+		assert.Nil(t, err)
+	})
+
+	t.Run("millisecond tick without aggressor and day code", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedTick, ",")
+		config := createConfig(0, "", false, false)
+		config.MicrosecondTicks = true
+
+		mappedRow, err := mapTick(columns, et, config)
+
+		assert.Equal(t, "2019-02-25 11:30:06.691,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87,,", mappedRow)
+		assert.Nil(t, err)
+	})
+
 	t.Run("too few columns", func(t *testing.T) {
 		columns := strings.Split(testTooFewColumnsIqfeedTick, ",")
 
@@ -120,6 +158,17 @@ func TestEodBarMapper(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("eod bar with iso8601 date", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedEodBar, ",")
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = TimeFormatISO8601
+
+		mappedRow, err := mapEodBar(columns, et, config)
+
+		assert.Equal(t, "2019-02-21T00:00:00-05:00,23.8700,24.0600,23.8038,24.0000,29183,0", mappedRow)
+		assert.Nil(t, err)
+	})
+
 	t.Run("too few columns", func(t *testing.T) {
 		columns := strings.Split(testTooFewColumnsIqfeedEodBar, ",")
 
@@ -139,6 +188,47 @@ func TestEodBarMapper(t *testing.T) {
 	})
 }
 
+func TestPeriodBarMapper(t *testing.T) {
+	t.Run("valid weekly bar", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedWeeklyBar, ",")
+
+		mappedRow, err := mapPeriodBar(columns, et, createConfig(0, "", false, false))
+
+		assert.Equal(t, "2019-02-15,23.4000,24.5000,23.1000,24.0000,151920,0", mappedRow)
+		assert.Nil(t, err)
+	})
+
+	t.Run("weekly bar before start date", func(t *testing.T) {
+		columns := strings.Split(testEarlyIqfeedWeeklyBar, ",")
+
+		mappedRow, err := mapPeriodBar(columns, et, createConfig(0, "", false, false))
+
+		assert.Equal(t, "", mappedRow)
+		assert.Nil(t, err)
+	})
+
+	t.Run("weekly bar without date filter", func(t *testing.T) {
+		columns := strings.Split(testEarlyIqfeedWeeklyBar, ",")
+		config := createConfig(0, "", false, false)
+		config.StartDate = ""
+		config.EndDate = ""
+
+		mappedRow, err := mapPeriodBar(columns, et, config)
+
+		assert.Equal(t, "2019-01-18,23.4000,24.5000,23.1000,24.0000,151920,0", mappedRow)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		columns := strings.Split(testTooFewColumnsIqfeedEodBar, ",")
+
+		mappedRow, err := mapPeriodBar(columns, et, createConfig(0, "", false, false))
+
+		assert.Equal(t, "", mappedRow)
+		assert.Errorf(t, err, "too few columns")
+	})
+}
+
 func TestMinuteBarMapper(t *testing.T) {
 	t.Run("valid minute bar with bar start timestamp", func(t *testing.T) {
 		columns := strings.Split(testValidIqfeedMinuteBar, ",")
@@ -258,6 +348,17 @@ func TestTickMapper(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("valid tick with epoch milliseconds", func(t *testing.T) {
+		columns := strings.Split(testValidIqfeedTick, ",")
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = TimeFormatEpochMillis
+
+		mappedRow, err := mapTick(columns, time.UTC, config)
+
+		assert.Equal(t, "1551112206691,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87", mappedRow)
+		assert.Nil(t, err)
+	})
+
 	t.Run("too few columns", func(t *testing.T) {
 		columns := strings.Split(testTooFewColumnsIqfeedTick, ",")
 
@@ -285,12 +386,36 @@ func TestCreateEodRequest(t *testing.T) {
 	})
 }
 
+func TestCreateWeeklyRequest(t *testing.T) {
+	t.Run("weekly request", func(t *testing.T) {
+		request := createWeeklyRequest("spy", "R91", createConfig(0, "", false, false))
+
+		assert.Equal(t, "HWX,SPY,,1,R91", request)
+	})
+}
+
+func TestCreateMonthlyRequest(t *testing.T) {
+	t.Run("monthly request", func(t *testing.T) {
+		request := createMonthlyRequest("spy", "R91", createConfig(0, "", false, false))
+
+		assert.Equal(t, "HMX,SPY,,1,R91", request)
+	})
+}
+
 func TestCreateMinuteRequest(t *testing.T) {
 	t.Run("minute request", func(t *testing.T) {
 		request := createMinuteRequest("spy", "R91", createConfig(0, "", false, false))
 
 		assert.Equal(t, "HIT,SPY,60,20190122,20190221,,,,1,R91", request)
 	})
+	t.Run("minute request in regular trading hours", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Session = SessionRegular
+
+		request := createMinuteRequest("spy", "R91", config)
+
+		assert.Equal(t, "HIT,SPY,60,20190122,20190221,,093000,160000,1,R91", request)
+	})
 }
 
 func TestCreateIntervalRequest(t *testing.T) {
@@ -304,36 +429,51 @@ func TestCreateIntervalRequest(t *testing.T) {
 
 		assert.Equal(t, "HIT,SPY,5,20190122,20190221,,,,1,R91,,S", request)
 	})
+	t.Run("interval request in custom session", func(t *testing.T) {
+		config := createConfig(5, "S", false, false)
+		config.Session = "custom 08:00-17:15"
+
+		request := createIntervalRequest("spy", "R91", config)
+
+		assert.Equal(t, "HIT,SPY,5,20190122,20190221,,080000,171500,1,R91,,S,1", request)
+	})
 }
 
 func TestCreateTickRequest(t *testing.T) {
 	t.Run("tick request", func(t *testing.T) {
 		request := createTickRequest("spy", "R91", createConfig(0, "", false, false))
 
+		assert.Equal(t, "HTT,SPY,20190122,20190221,,,,1,R91", request)
+	})
+	t.Run("tick request in session wrapping midnight", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Session = "18:00-17:00"
+
+		request := createTickRequest("spy", "R91", config)
+
 		assert.Equal(t, "HTT,SPY,20190122,20190221,,,,1,R91", request)
 	})
 }
 
 func createConfig(intervalLength int, intervalType string, endTimestamp bool, tsv bool) *Config {
 	var config = Config{
-		protocol:        "5.1",
-		command:         "",
-		startDate:       "20190122",
-		endDate:         "20190221",
-		outDirectory:    "data",
-		intervalType:    intervalType,
-		intervalLength:  intervalLength,
-		parallelism:     8,
-		tsv:             tsv,
-		detailedLogging: false,
-		gzip:            false,
-		endTimestamp:    endTimestamp,
-		useLabels:       false,
+		Protocol:        "5.1",
+		Command:         "",
+		StartDate:       "20190122",
+		EndDate:         "20190221",
+		OutDirectory:    "data",
+		IntervalType:    intervalType,
+		IntervalLength:  intervalLength,
+		TSV:             tsv,
+		DetailedLogging: false,
+		Gzip:            false,
+		EndTimestamp:    endTimestamp,
+		UseLabels:       false,
 	}
 
 	if intervalLength > 0 && !endTimestamp {
-		config.protocol = "6.0"
-		config.useLabels = true
+		config.Protocol = "6.0"
+		config.UseLabels = true
 	}
 
 	return &config
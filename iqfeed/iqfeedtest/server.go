@@ -0,0 +1,273 @@
+// Package iqfeedtest provides a scriptable fake IQFeed historical lookup server for integration tests,
+// replying to requests with fixture rows, IQFeed errors, malformed rows, slow responses and disconnects.
+package iqfeedtest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is a historical data or symbol lookup request received by the server.
+// The symbol of the SBF, SBS and SBN lookups is the search string, and of the CEO and CFO chains the underlying.
+type Request struct {
+	Command   string
+	Symbol    string
+	BeginDate string
+	EndDate   string
+	RequestId string
+	Fields    []string
+}
+
+// Response is the scripted reply to a request. The rows are sent prefixed with the request id,
+// followed by the error message if set and the end message unless the connection is disconnected.
+type Response struct {
+	// Rows are the data columns of each row after the request id, sent as is so they can be malformed
+	Rows []string
+	// Error is an IQFeed error message such as !NO_DATA!, sent after the rows
+	Error string
+	// Delay is the delay before each row
+	Delay time.Duration
+	// Disconnect closes the connection after the rows instead of sending the end message
+	Disconnect bool
+}
+
+// Handler returns the response to a request
+type Handler func(request Request) Response
+
+// Server is a fake IQFeed historical lookup server listening on a random local port
+type Server struct {
+	listener net.Listener
+	handler  Handler
+
+	mu          sync.Mutex
+	requests    []Request
+	protocol    string
+	connections int
+	conns       map[net.Conn]struct{}
+	wg          sync.WaitGroup
+}
+
+// NewServer starts a server replying to requests with the handler, the caller should call Close when finished
+func NewServer(handler Handler) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		panic(fmt.Sprintf("iqfeedtest: could not listen on a port: %s", err))
+	}
+
+	s := &Server{listener: listener, handler: handler, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// Fixtures returns a handler replying with the response of the requested symbol, or !NO_DATA! for other symbols
+func Fixtures(responses map[string]Response) Handler {
+	return func(request Request) Response {
+		response, found := responses[strings.ToUpper(request.Symbol)]
+
+		if !found {
+			return Response{Error: "!NO_DATA!"}
+		}
+
+		return response
+	}
+}
+
+// Host returns the host the server is listening on
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server is listening on
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// Protocol returns the protocol set by the last S,SET PROTOCOL message
+func (s *Server) Protocol() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.protocol
+}
+
+// Connections returns the number of accepted connections
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections
+}
+
+// Close stops the server and closes all open connections
+func (s *Server) Close() {
+	_ = s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.connections++
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+
+		if fields[0] == "S" {
+			if len(fields) >= 3 && fields[1] == "SET PROTOCOL" {
+				s.mu.Lock()
+				s.protocol = fields[2]
+				s.mu.Unlock()
+
+				_, err := fmt.Fprintf(conn, "S,CURRENT PROTOCOL,%s\r\n", fields[2])
+
+				if err != nil {
+					return
+				}
+			}
+
+			continue
+		}
+
+		request, err := parseRequest(fields)
+
+		if err != nil {
+			_, _ = fmt.Fprintf(conn, "E,!SYNTAX_ERROR!,\r\n")
+			continue
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, request)
+		s.mu.Unlock()
+
+		if !s.reply(conn, request, s.handler(request)) {
+			return
+		}
+	}
+}
+
+// reply writes the response and returns false when the connection is closed
+func (s *Server) reply(conn net.Conn, request Request, response Response) bool {
+	for _, row := range response.Rows {
+		if response.Delay > 0 {
+			time.Sleep(response.Delay)
+		}
+
+		_, err := fmt.Fprintf(conn, "%s,%s\r\n", request.RequestId, row)
+
+		if err != nil {
+			return false
+		}
+	}
+
+	if response.Disconnect {
+		return false
+	}
+
+	if response.Error != "" {
+		_, err := fmt.Fprintf(conn, "%s,E,%s,,\r\n", request.RequestId, response.Error)
+
+		if err != nil {
+			return false
+		}
+	}
+
+	_, err := fmt.Fprintf(conn, "%s,!ENDMSG!,\r\n", request.RequestId)
+	return err == nil
+}
+
+// parseRequest parses the symbol, date range and request id of the historical, symbol lookup and option chain requests
+func parseRequest(fields []string) (Request, error) {
+	// Positions of the symbol, begin date, end date and request id fields, -1 when the request has none
+	positions := map[string][4]int{
+		"HDT": {1, 2, 3, 6},
+		"HWX": {1, -1, -1, 4},
+		"HMX": {1, -1, -1, 4},
+		"HIT": {1, 3, 4, 9},
+		"HTT": {1, 2, 3, 8},
+		"HDX": {1, -1, -1, 4},
+		"HID": {1, -1, -1, 8},
+		"HIX": {1, -1, -1, 5},
+		"HTD": {1, -1, -1, 7},
+		"HTX": {1, -1, -1, 4},
+		"SBF": {2, -1, -1, 5},
+		"SBS": {1, -1, -1, 2},
+		"SBN": {1, -1, -1, 2},
+		"SLM": {-1, -1, -1, 1},
+		"SST": {-1, -1, -1, 1},
+		"CEO": {1, -1, -1, 9},
+		"CFO": {1, -1, -1, 6},
+	}
+
+	position, found := positions[fields[0]]
+
+	if !found || len(fields) <= position[3] {
+		return Request{}, fmt.Errorf("unsupported request: %s", strings.Join(fields, ","))
+	}
+
+	request := Request{Command: fields[0], RequestId: fields[position[3]], Fields: fields}
+
+	if position[0] >= 0 {
+		request.Symbol = fields[position[0]]
+	}
+
+	if position[1] >= 0 {
+		request.BeginDate = fields[position[1]]
+		request.EndDate = fields[position[2]]
+	}
+
+	return request, nil
+}
@@ -0,0 +1,332 @@
+package iqfeed
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	errTooFewColumns = errors.New("too few columns")
+	errOutsideRange  = errors.New("outside date range")
+)
+
+// Bar is a daily, weekly, monthly or interval bar
+type Bar struct {
+	Time         time.Time
+	Open         float64
+	High         float64
+	Low          float64
+	Close        float64
+	Volume       int64
+	OpenInterest int64
+}
+
+// Tick is a trade with the bid and ask at the time of the trade
+type Tick struct {
+	Time        time.Time
+	Last        float64
+	LastSize    int64
+	TotalVolume int64
+	Bid         float64
+	Ask         float64
+	TickId      int64
+	Basis       string
+	Market      int
+	Conditions  string
+}
+
+type barParser func(iqfeedRow []string, location *time.Location) (Bar, error)
+
+// BarIterator iterates over the bars of a request:
+//
+//	bars, err := client.EOD(ctx, "SPY", from, to)
+//	...
+//	defer bars.Close()
+//	for bars.Next() {
+//		bar := bars.Bar()
+//	}
+//	err = bars.Err()
+type BarIterator struct {
+	rows  *rowIterator
+	parse barParser
+	bar   Bar
+}
+
+// Next advances to the next bar and returns false at the end of the data or after an error
+func (it *BarIterator) Next() bool {
+	for it.rows.next() {
+		bar, err := it.parse(it.rows.row, it.rows.location)
+
+		if err == errTooFewColumns || err == errOutsideRange {
+			continue
+		} else if err != nil {
+			it.rows.fail(err)
+			return false
+		}
+
+		it.bar = bar
+		return true
+	}
+
+	return false
+}
+
+// Bar returns the current bar
+func (it *BarIterator) Bar() Bar {
+	return it.bar
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *BarIterator) Err() error {
+	return it.rows.err
+}
+
+// Close closes the connection of the request
+func (it *BarIterator) Close() error {
+	return it.rows.close()
+}
+
+// TickIterator iterates over the ticks of a request in the same way as BarIterator
+type TickIterator struct {
+	rows *rowIterator
+	tick Tick
+}
+
+// Next advances to the next tick and returns false at the end of the data or after an error
+func (it *TickIterator) Next() bool {
+	for it.rows.next() {
+		tick, err := parseTick(it.rows.row, it.rows.location)
+
+		if err == errTooFewColumns || err == errOutsideRange {
+			continue
+		} else if err != nil {
+			it.rows.fail(err)
+			return false
+		}
+
+		it.tick = tick
+		return true
+	}
+
+	return false
+}
+
+// Tick returns the current tick
+func (it *TickIterator) Tick() Tick {
+	return it.tick
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *TickIterator) Err() error {
+	return it.rows.err
+}
+
+// Close closes the connection of the request
+func (it *TickIterator) Close() error {
+	return it.rows.close()
+}
+
+// rowIterator reads the data rows of a request and closes the connection when the context is done
+type rowIterator struct {
+	ctx        context.Context
+	connection *Conn
+	requestId  string
+	location   *time.Location
+	row        []string
+	err        error
+	done       bool
+	stopWatch  func()
+	closeOnce  sync.Once
+	closeError error
+}
+
+func newRowIterator(ctx context.Context, connection *Conn, requestId string, location *time.Location) *rowIterator {
+	return &rowIterator{
+		ctx:        ctx,
+		connection: connection,
+		requestId:  requestId,
+		location:   location,
+		stopWatch:  connection.watch(ctx),
+	}
+}
+
+func (it *rowIterator) next() bool {
+	if it.done {
+		return false
+	}
+
+	for {
+		iqfeedRow, err := it.connection.read()
+
+		if err != nil {
+			if it.ctx.Err() != nil {
+				err = it.ctx.Err()
+			} else if err == io.EOF {
+				err = errConnectionClosed
+			}
+
+			it.fail(err)
+			return false
+		}
+
+		data, err := checkRow(iqfeedRow, it.requestId)
+
+		if err == io.EOF || isNoData(err) {
+			it.done = true
+			_ = it.close()
+			return false
+		} else if err != nil {
+			it.fail(err)
+			return false
+		} else if data {
+			it.row = iqfeedRow
+			return true
+		}
+	}
+}
+
+func (it *rowIterator) fail(err error) {
+	it.err = err
+	it.done = true
+	_ = it.close()
+}
+
+func (it *rowIterator) close() error {
+	it.closeOnce.Do(func() {
+		it.stopWatch()
+		it.closeError = it.connection.Close()
+	})
+
+	return it.closeError
+}
+
+// fieldParser parses numeric fields and keeps the first error, empty fields are parsed as zero
+type fieldParser struct {
+	err error
+}
+
+func (p *fieldParser) float(value string) float64 {
+	if value == "" || p.err != nil {
+		return 0
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	p.err = err
+	return number
+}
+
+func (p *fieldParser) int(value string) int64 {
+	if value == "" || p.err != nil {
+		return 0
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	p.err = err
+	return number
+}
+
+func (p *fieldParser) time(layout string, value string, location *time.Location) time.Time {
+	if p.err != nil {
+		return time.Time{}
+	}
+
+	timestamp, err := time.ParseInLocation(layout, value, sourceLocation)
+	p.err = err
+	return timestamp.In(location)
+}
+
+func parseDailyBar(iqfeedRow []string, location *time.Location) (Bar, error) {
+	if len(iqfeedRow) < 8 {
+		return Bar{}, errTooFewColumns
+	}
+
+	// Dates are not converted to the target time zone, same as the EOD files
+	date := iqfeedRow[1]
+
+	if len(date) > len(dateFormat) {
+		date = date[:len(dateFormat)]
+	}
+
+	parser := fieldParser{}
+	timestamp, err := time.ParseInLocation(dateFormat, date, location)
+	parser.err = err
+
+	// Columns from IQFeed: timestamp, high, low, open, close, volume, openInterest
+	bar := Bar{
+		Time:         timestamp,
+		High:         parser.float(iqfeedRow[2]),
+		Low:          parser.float(iqfeedRow[3]),
+		Open:         parser.float(iqfeedRow[4]),
+		Close:        parser.float(iqfeedRow[5]),
+		Volume:       parser.int(iqfeedRow[6]),
+		OpenInterest: parser.int(iqfeedRow[7]),
+	}
+
+	return bar, parser.err
+}
+
+// periodBarParser filters weekly and monthly bars by date, since their requests do not support a date range
+func periodBarParser(from, to time.Time) barParser {
+	return func(iqfeedRow []string, location *time.Location) (Bar, error) {
+		bar, err := parseDailyBar(iqfeedRow, location)
+
+		if err != nil {
+			return bar, err
+		}
+
+		date := bar.Time.Format(requestDateFormat)
+
+		if (!from.IsZero() && date < from.Format(requestDateFormat)) || (!to.IsZero() && date > to.Format(requestDateFormat)) {
+			return Bar{}, errOutsideRange
+		}
+
+		return bar, nil
+	}
+}
+
+func parseIntervalBar(iqfeedRow []string, location *time.Location) (Bar, error) {
+	if len(iqfeedRow) < 8 {
+		return Bar{}, errTooFewColumns
+	}
+
+	parser := fieldParser{}
+
+	// Columns from IQFeed: timestamp, high, low, open, close, totalVolume, periodVolume, numberOfTrades
+	bar := Bar{
+		Time:   parser.time(secondTimestampFormat, iqfeedRow[1], location),
+		High:   parser.float(iqfeedRow[2]),
+		Low:    parser.float(iqfeedRow[3]),
+		Open:   parser.float(iqfeedRow[4]),
+		Close:  parser.float(iqfeedRow[5]),
+		Volume: parser.int(iqfeedRow[7]),
+	}
+
+	return bar, parser.err
+}
+
+func parseTick(iqfeedRow []string, location *time.Location) (Tick, error) {
+	if len(iqfeedRow) < 11 {
+		return Tick{}, errTooFewColumns
+	}
+
+	parser := fieldParser{}
+
+	tick := Tick{
+		Time:        parser.time(millisecondTimestampFormat, iqfeedRow[1], location),
+		Last:        parser.float(iqfeedRow[2]),
+		LastSize:    parser.int(iqfeedRow[3]),
+		TotalVolume: parser.int(iqfeedRow[4]),
+		Bid:         parser.float(iqfeedRow[5]),
+		Ask:         parser.float(iqfeedRow[6]),
+		TickId:      parser.int(iqfeedRow[7]),
+		Basis:       iqfeedRow[8],
+		Market:      int(parser.int(iqfeedRow[9])),
+		Conditions:  iqfeedRow[10],
+	}
+
+	return tick, parser.err
+}
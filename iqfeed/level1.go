@@ -0,0 +1,161 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	updateMessage   = "Q"
+	summaryMessage  = "P"
+	notFoundMessage = "n"
+	syncInterval    = time.Second
+	level1Header    = "datetime,type,last,lastsize,totalsize,bid,ask,bidsize,asksize,lasttime,market,content"
+)
+
+// level1Fields are the update fields selected for streaming, the messages start with the type and symbol
+var level1Fields = []string{
+	"Most Recent Trade",
+	"Most Recent Trade Size",
+	"Total Volume",
+	"Bid",
+	"Ask",
+	"Bid Size",
+	"Ask Size",
+	"Most Recent Trade Time",
+	"Most Recent Trade Market Center",
+	"Message Contents",
+}
+
+// Stream watches the Level 1 trades and quotes of the symbols and appends them to per-symbol files rotated daily,
+// until the context is done. A lost connection is reconnected with the retry options of the config.
+func Stream(ctx context.Context, symbols []string, config *Config) error {
+	location, err := LoadLocation(config.TimeZone)
+
+	if err != nil {
+		return fmt.Errorf("could not load target time zone: %s", err)
+	}
+
+	files := newDailyFiles(level1Header, config)
+	defer files.close()
+
+	err = streamWithReconnect(ctx, config, func() (bool, error) {
+		return streamLevel1(ctx, symbols, files, location, config)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return files.close()
+}
+
+// streamLevel1 streams until the connection is lost or the context is done, and returns true if any update was received
+func streamLevel1(ctx context.Context, symbols []string, files *streamFiles, location *time.Location, config *Config) (received bool, err error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", level1Address(config))
+
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	stopWatch := watchConn(ctx, conn)
+	defer stopWatch()
+
+	requests := []string{
+		fmt.Sprintf("S,SET PROTOCOL,%s", config.Protocol),
+		fmt.Sprintf("S,SELECT UPDATE FIELDS,%s", strings.Join(level1Fields, ",")),
+	}
+
+	for _, symbol := range symbols {
+		requests = append(requests, fmt.Sprintf("w%s", strings.ToUpper(symbol)))
+	}
+
+	for _, request := range requests {
+		_, err = fmt.Fprintf(conn, "%s\r\n", request)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	log.WithFields(log.Fields{"symbols": len(symbols), "address": level1Address(config)}).Info("Streaming")
+
+	reader := csv.NewReader(bufio.NewReaderSize(conn, bufferSize))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	lastSync := time.Now()
+
+	for {
+		iqfeedRow, err := reader.Read()
+
+		if err != nil && ctx.Err() != nil {
+			return received, nil
+		} else if err == io.EOF {
+			return received, errConnectionClosed
+		} else if err != nil {
+			return received, err
+		}
+
+		if config.DetailedLogging {
+			log.Debug(strings.Join(iqfeedRow, ","))
+		}
+
+		switch iqfeedRow[0] {
+		case updateMessage, summaryMessage:
+			timestamp := time.Now().In(location)
+			symbol, row, err := mapLevel1Update(iqfeedRow, timestamp, config)
+
+			if err != nil {
+				log.WithError(err).Debug("Skipped update")
+				break
+			}
+
+			err = files.write(symbol, timestamp, row)
+
+			if err != nil {
+				return received, fmt.Errorf("could not write update: %s", err)
+			}
+
+			received = true
+		case notFoundMessage:
+			if len(iqfeedRow) >= 2 {
+				log.WithField("symbol", iqfeedRow[1]).Warn("Symbol not found")
+			}
+		case errorMessage:
+			log.WithField("error", strings.Join(iqfeedRow[1:], ",")).Error("IQFeed error")
+		}
+
+		if time.Since(lastSync) >= syncInterval {
+			err = files.sync()
+
+			if err != nil {
+				return received, fmt.Errorf("could not write update: %s", err)
+			}
+
+			lastSync = time.Now()
+		}
+	}
+}
+
+// mapLevel1Update maps an update or summary message to an output row timestamped with the receive time
+func mapLevel1Update(iqfeedRow []string, timestamp time.Time, config *Config) (symbol string, outputRow string, err error) {
+	if len(iqfeedRow) < 2+len(level1Fields) {
+		return "", "", errTooFewColumns
+	}
+
+	// Columns from IQFeed:
+	// 0     1       2 ...
+	// type, symbol, selected update fields
+	columns := append([]string{timestamp.Format(millisecondTimestampFormat), iqfeedRow[0]}, iqfeedRow[2:2+len(level1Fields)]...)
+	return iqfeedRow[1], joinColumns(config, columns...), nil
+}
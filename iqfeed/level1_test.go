@@ -0,0 +1,156 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testLevel1Summary = "P,SPY,279.5000,100,61252110,279.4900,279.5100,1200,900,15:59:59.921483,11,,"
+	testLevel1Update  = "Q,SPY,279.5100,200,61252310,279.5000,279.5200,300,800,16:00:00.004671,19,Cba,"
+)
+
+func TestMapLevel1Update(t *testing.T) {
+	timestamp := time.Date(2019, 2, 26, 16, 0, 0, 5000000, et)
+
+	t.Run("update to csv", func(t *testing.T) {
+		symbol, row, err := mapLevel1Update(strings.Split(testLevel1Update, ","), timestamp, createConfig(0, "", false, false))
+
+		assert.Equal(t, "SPY", symbol)
+		assert.Equal(t, "2019-02-26 16:00:00.005,Q,279.5100,200,61252310,279.5000,279.5200,300,800,16:00:00.004671,19,Cba", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("summary to tsv", func(t *testing.T) {
+		_, row, err := mapLevel1Update(strings.Split(testLevel1Summary, ","), timestamp, createConfig(0, "", false, true))
+
+		assert.Equal(t, "2019-02-26 16:00:00.005\tP\t279.5000\t100\t61252110\t279.4900\t279.5100\t1200\t900\t15:59:59.921483\t11\t", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		_, _, err := mapLevel1Update([]string{"Q", "SPY", "279.5100"}, timestamp, createConfig(0, "", false, false))
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+}
+
+func TestStream(t *testing.T) {
+	t.Run("writes updates until disconnected", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+		requests := make(chan []string, 1)
+
+		go func() {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			var received []string
+			scanner := bufio.NewScanner(conn)
+
+			for scanner.Scan() {
+				received = append(received, strings.TrimRight(scanner.Text(), "\r"))
+
+				if strings.HasPrefix(received[len(received)-1], "wBAD") {
+					break
+				}
+			}
+
+			requests <- received
+			_, _ = fmt.Fprintf(conn, "S,CURRENT UPDATE FIELDNAMES,Symbol,%s\r\n", strings.Join(level1Fields, ","))
+			_, _ = fmt.Fprintf(conn, "%s\r\nn,BAD\r\nT,20190226 16:00:00\r\n%s\r\n", testLevel1Summary, testLevel1Update)
+		}()
+
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.Level1Port = listener.Addr().(*net.TCPAddr).Port
+		config.ReconnectLimit = 0
+		config.TimeZone = "UTC"
+
+		err := Stream(context.Background(), []string{"spy", "bad"}, config)
+		day := time.Now().UTC().Format(dateFormat)
+		content := readTestFile(t, filepath.Join(config.OutDirectory, fmt.Sprintf("SPY-%s.csv", day)))
+		rows := strings.Split(strings.TrimSpace(content), "\n")
+
+		assert.Equal(t, errConnectionClosed, err)
+		assert.Equal(t, []string{
+			"S,SET PROTOCOL,5.1",
+			"S,SELECT UPDATE FIELDS," + strings.Join(level1Fields, ","),
+			"wSPY",
+			"wBAD",
+		}, <-requests)
+		assert.Equal(t, 3, len(rows))
+		assert.Equal(t, level1Header, rows[0])
+		assert.Contains(t, rows[1], ",P,279.5000,100,")
+		assert.Contains(t, rows[2], ",Q,279.5100,200,")
+		assert.Equal(t, []string{fmt.Sprintf("SPY-%s.csv", day)}, listTestFiles(t, config.OutDirectory))
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+
+		go func() {
+			conn, err := listener.Accept()
+
+			if err == nil {
+				defer conn.Close()
+				_, _ = bufio.NewReader(conn).ReadString('\n')
+				time.Sleep(time.Second)
+			}
+		}()
+
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.Level1Port = listener.Addr().(*net.TCPAddr).Port
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := Stream(ctx, []string{"spy"}, config)
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestDailyFiles(t *testing.T) {
+	t.Run("rotate at midnight", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		files := newDailyFiles("datetime,value", config)
+
+		_ = files.write("spy", time.Date(2019, 2, 26, 23, 59, 59, 0, et), "2019-02-26 23:59:59,1")
+		_ = files.write("spy", time.Date(2019, 2, 27, 0, 0, 0, 0, et), "2019-02-27 00:00:00,2")
+		err := files.close()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "datetime,value\n2019-02-26 23:59:59,1\n", readTestFile(t, filepath.Join(config.OutDirectory, "SPY-2019-02-26.csv")))
+		assert.Equal(t, "datetime,value\n2019-02-27 00:00:00,2\n", readTestFile(t, filepath.Join(config.OutDirectory, "SPY-2019-02-27.csv")))
+	})
+
+	t.Run("append to existing file", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		timestamp := time.Date(2019, 2, 26, 9, 30, 0, 0, et)
+
+		first := newDailyFiles("datetime,value", config)
+		_ = first.write("spy", timestamp, "2019-02-26 09:30:00,1")
+		_ = first.close()
+		second := newDailyFiles("datetime,value", config)
+		_ = second.write("spy", timestamp, "2019-02-26 09:30:00,2")
+		_ = second.close()
+
+		assert.Equal(t, "datetime,value\n2019-02-26 09:30:00,1\n2019-02-26 09:30:00,2\n", readTestFile(t, filepath.Join(config.OutDirectory, "SPY-2019-02-26.csv")))
+	})
+}
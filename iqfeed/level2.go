@@ -0,0 +1,322 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	depthUpdateMessage  = "Z"
+	depthSummaryMessage = "2"
+	depthTimeFormat     = "2006-01-02 15:04:05.999999"
+	depthHeader         = "datetime,type,mmid,bid,bidsize,bidtime,ask,asksize,asktime,cond,bidvalid,askvalid"
+	snapshotHeader      = "datetime,mmid,bid,bidsize,bidtime,ask,asksize,asktime,bidvalid,askvalid"
+)
+
+// depthQuote is the last bid and ask of a market maker, with the quote times in the target time zone
+type depthQuote struct {
+	bid       string
+	bidSize   string
+	bidTime   string
+	ask       string
+	askSize   string
+	askTime   string
+	condition string
+	bidValid  string
+	askValid  string
+}
+
+// depthBook is the last quote of each market maker of a symbol
+type depthBook map[string]depthQuote
+
+// StreamDepth watches the Level 2 market maker quotes of the symbols and appends the updates to per-symbol files
+// rotated daily, until the context is done. With a snapshot interval the full book of each symbol is also written
+// periodically to snapshot files. A lost connection is reconnected with the retry options of the config.
+func StreamDepth(ctx context.Context, symbols []string, config *Config) error {
+	location, err := LoadLocation(config.TimeZone)
+
+	if err != nil {
+		return fmt.Errorf("could not load target time zone: %s", err)
+	}
+
+	updates := newStreamFiles(depthHeader, config, func(symbol string, timestamp time.Time) string {
+		return getFilename(fmt.Sprintf("%s-depth-%s", symbol, timestamp.Format(dateFormat)), config)
+	})
+	defer updates.close()
+
+	snapshots := newStreamFiles(snapshotHeader, config, func(symbol string, timestamp time.Time) string {
+		return getFilename(fmt.Sprintf("%s-snapshot-%s", symbol, timestamp.Format(dateFormat)), config)
+	})
+	defer snapshots.close()
+
+	err = streamWithReconnect(ctx, config, func() (bool, error) {
+		return streamLevel2(ctx, symbols, updates, snapshots, location, config)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = updates.close()
+
+	if err != nil {
+		return err
+	}
+
+	return snapshots.close()
+}
+
+// streamLevel2 streams until the connection is lost or the context is done, and returns true if any update was received
+func streamLevel2(ctx context.Context, symbols []string, updates *streamFiles, snapshots *streamFiles, location *time.Location, config *Config) (received bool, err error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", level2Address(config))
+
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	stopWatch := watchConn(ctx, conn)
+	defer stopWatch()
+
+	requests := []string{fmt.Sprintf("S,SET PROTOCOL,%s", config.Protocol)}
+
+	for _, symbol := range symbols {
+		requests = append(requests, fmt.Sprintf("w%s", strings.ToUpper(symbol)))
+	}
+
+	for _, request := range requests {
+		_, err = fmt.Fprintf(conn, "%s\r\n", request)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	log.WithFields(log.Fields{"symbols": len(symbols), "address": level2Address(config)}).Info("Streaming")
+
+	// The books are rebuilt from the summary messages sent for every watched symbol
+	books := map[string]depthBook{}
+	marketMakers := map[string]bool{}
+
+	for _, marketMaker := range config.MarketMakers {
+		marketMakers[strings.ToUpper(marketMaker)] = true
+	}
+
+	// Rows are read in the background so snapshots are written on time while the book is quiet
+	stop := make(chan struct{})
+	defer close(stop)
+	rows := readRows(conn, stop)
+
+	var snapshotTicks <-chan time.Time
+
+	if config.SnapshotInterval > 0 {
+		ticker := time.NewTicker(config.SnapshotInterval)
+		defer ticker.Stop()
+		snapshotTicks = ticker.C
+	}
+
+	lastSync := time.Now()
+
+	for {
+		if time.Since(lastSync) >= syncInterval {
+			err = updates.sync()
+
+			if err == nil {
+				err = snapshots.sync()
+			}
+
+			if err != nil {
+				return received, fmt.Errorf("could not write depth update: %s", err)
+			}
+
+			lastSync = time.Now()
+		}
+
+		var iqfeedRow []string
+
+		select {
+		case <-snapshotTicks:
+			err = writeSnapshots(books, snapshots, time.Now().In(location), config)
+
+			if err != nil {
+				return received, fmt.Errorf("could not write depth snapshot: %s", err)
+			}
+
+			continue
+		case row := <-rows:
+			iqfeedRow, err = row.values, row.err
+		}
+
+		if err != nil && ctx.Err() != nil {
+			return received, nil
+		} else if err == io.EOF {
+			return received, errConnectionClosed
+		} else if err != nil {
+			return received, err
+		}
+
+		if config.DetailedLogging {
+			log.Debug(strings.Join(iqfeedRow, ","))
+		}
+
+		switch iqfeedRow[0] {
+		case depthUpdateMessage, depthSummaryMessage:
+			timestamp := time.Now().In(location)
+			symbol, marketMaker, quote, err := mapDepthQuote(iqfeedRow, location)
+
+			if err != nil {
+				log.WithError(err).Debug("Skipped depth update")
+				break
+			}
+
+			if len(marketMakers) > 0 && !marketMakers[marketMaker] {
+				break
+			}
+
+			if books[symbol] == nil {
+				books[symbol] = depthBook{}
+			}
+
+			books[symbol][marketMaker] = quote
+			err = updates.write(symbol, timestamp, formatDepthUpdate(timestamp, iqfeedRow[0], marketMaker, quote, config))
+
+			if err != nil {
+				return received, fmt.Errorf("could not write depth update: %s", err)
+			}
+
+			received = true
+		case notFoundMessage:
+			if len(iqfeedRow) >= 2 {
+				log.WithField("symbol", iqfeedRow[1]).Warn("Symbol not found")
+			}
+		case errorMessage:
+			log.WithField("error", strings.Join(iqfeedRow[1:], ",")).Error("IQFeed error")
+		}
+	}
+}
+
+// readRow is a row read from a connection, or the error that ended the reads
+type readRow struct {
+	values []string
+	err    error
+}
+
+// readRows reads the rows of the connection until a read fails, which is sent as the last row, or until stopped
+func readRows(conn net.Conn, stop <-chan struct{}) <-chan readRow {
+	rows := make(chan readRow)
+	reader := csv.NewReader(bufio.NewReaderSize(conn, bufferSize))
+	reader.FieldsPerRecord = -1
+
+	go func() {
+		for {
+			values, err := reader.Read()
+
+			select {
+			case rows <- readRow{values: values, err: err}:
+			case <-stop:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return rows
+}
+
+// level2Address returns the address of the IQFeed Level 2 port, 127.0.0.1:9200 by default
+func level2Address(config *Config) string {
+	return address(config.Host, config.Level2Port, DefaultLevel2Port)
+}
+
+// mapDepthQuote maps a market maker update or summary message
+func mapDepthQuote(iqfeedRow []string, location *time.Location) (symbol string, marketMaker string, quote depthQuote, err error) {
+	if len(iqfeedRow) < 13 {
+		return "", "", depthQuote{}, errTooFewColumns
+	}
+
+	// Columns from IQFeed:
+	// 0     1       2     3    4    5        6        7        8     9              10       11            12
+	// type, symbol, mmid, bid, ask, bidSize, askSize, bidTime, date, conditionCode, askTime, bidInfoValid, askInfoValid, endOfMessageGroup
+	quote = depthQuote{
+		bid:       iqfeedRow[3],
+		bidSize:   iqfeedRow[5],
+		bidTime:   convertDepthTime(iqfeedRow[8], iqfeedRow[7], location),
+		ask:       iqfeedRow[4],
+		askSize:   iqfeedRow[6],
+		askTime:   convertDepthTime(iqfeedRow[8], iqfeedRow[10], location),
+		condition: iqfeedRow[9],
+		bidValid:  iqfeedRow[11],
+		askValid:  iqfeedRow[12],
+	}
+
+	return strings.ToUpper(iqfeedRow[1]), strings.ToUpper(iqfeedRow[2]), quote, nil
+}
+
+// convertDepthTime converts the date and time of a quote to a millisecond timestamp in the target time zone,
+// or an empty string when the quote has no valid time
+func convertDepthTime(date string, clock string, location *time.Location) string {
+	timestamp, err := time.ParseInLocation(depthTimeFormat, fmt.Sprintf("%s %s", date, clock), sourceLocation)
+
+	if err != nil {
+		return ""
+	}
+
+	return timestamp.In(location).Format(millisecondTimestampFormat)
+}
+
+func formatDepthUpdate(timestamp time.Time, messageType string, marketMaker string, quote depthQuote, config *Config) string {
+	return joinColumns(config,
+		timestamp.Format(millisecondTimestampFormat), messageType, marketMaker,
+		quote.bid, quote.bidSize, quote.bidTime, quote.ask, quote.askSize, quote.askTime,
+		quote.condition, quote.bidValid, quote.askValid)
+}
+
+// writeSnapshots writes the full book of every symbol, sorted by market maker
+func writeSnapshots(books map[string]depthBook, snapshots *streamFiles, timestamp time.Time, config *Config) error {
+	for symbol, book := range books {
+		marketMakers := make([]string, 0, len(book))
+
+		for marketMaker := range book {
+			marketMakers = append(marketMakers, marketMaker)
+		}
+
+		sort.Strings(marketMakers)
+
+		for _, marketMaker := range marketMakers {
+			quote := book[marketMaker]
+			row := joinColumns(config,
+				timestamp.Format(millisecondTimestampFormat), marketMaker,
+				quote.bid, quote.bidSize, quote.bidTime, quote.ask, quote.askSize, quote.askTime,
+				quote.bidValid, quote.askValid)
+
+			err := snapshots.write(symbol, timestamp, row)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func joinColumns(config *Config, columns ...string) string {
+	if config.TSV {
+		return strings.Join(columns, tsvSeparator)
+	}
+
+	return strings.Join(columns, csvSeparator)
+}
@@ -0,0 +1,104 @@
+package iqfeed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testDepthSummary = "2,SPY,NSDQ,279.4900,279.5100,300,500,12:21:59.123456,2019-02-26,52,12:21:59.654321,T,T,T,"
+	testDepthUpdate  = "Z,SPY,ARCX,279.5000,279.5200,200,100,12:22:00.004671,2019-02-26,52,12:22:00.001000,T,T,T,"
+)
+
+func TestMapDepthQuote(t *testing.T) {
+	t.Run("update", func(t *testing.T) {
+		symbol, marketMaker, quote, err := mapDepthQuote(strings.Split(testDepthUpdate, ","), time.UTC)
+
+		assert.Equal(t, "SPY", symbol)
+		assert.Equal(t, "ARCX", marketMaker)
+		assert.Equal(t, depthQuote{
+			bid:       "279.5000",
+			bidSize:   "200",
+			bidTime:   "2019-02-26 17:22:00.004",
+			ask:       "279.5200",
+			askSize:   "100",
+			askTime:   "2019-02-26 17:22:00.001",
+			condition: "52",
+			bidValid:  "T",
+			askValid:  "T",
+		}, quote)
+		assert.Nil(t, err)
+	})
+
+	t.Run("no quote time", func(t *testing.T) {
+		columns := strings.Split(testDepthUpdate, ",")
+		columns[7] = ""
+
+		_, _, quote, err := mapDepthQuote(columns, et)
+
+		assert.Equal(t, "", quote.bidTime)
+		assert.Nil(t, err)
+	})
+
+	t.Run("too few columns", func(t *testing.T) {
+		_, _, _, err := mapDepthQuote([]string{"Z", "SPY", "ARCX"}, et)
+
+		assert.Equal(t, errTooFewColumns, err)
+	})
+}
+
+func TestStreamDepth(t *testing.T) {
+	t.Run("write updates and snapshots of selected market makers", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer listener.Close()
+
+		go func() {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			reader := bufio.NewReader(conn)
+			_, _ = reader.ReadString('\n')
+			_, _ = reader.ReadString('\n')
+			otherMarketMaker := strings.Replace(testDepthUpdate, "ARCX", "EDGX", 1)
+			_, _ = fmt.Fprintf(conn, "%s\r\n%s\r\nT,20190226 12:22:00\r\n%s\r\n", testDepthSummary, otherMarketMaker, testDepthUpdate)
+
+			// The book stays quiet until disconnected
+			time.Sleep(200 * time.Millisecond)
+		}()
+
+		config := createConfig(0, "", false, false)
+		config.OutDirectory = t.TempDir()
+		config.Level2Port = listener.Addr().(*net.TCPAddr).Port
+		config.ReconnectLimit = 0
+		config.TimeZone = "UTC"
+		config.MarketMakers = []string{"nsdq", "arcx"}
+		config.SnapshotInterval = 20 * time.Millisecond
+
+		err := StreamDepth(context.Background(), []string{"spy"}, config)
+		day := time.Now().UTC().Format(dateFormat)
+		updates := strings.Split(strings.TrimSpace(readTestFile(t, filepath.Join(config.OutDirectory, fmt.Sprintf("SPY-depth-%s.csv", day)))), "\n")
+		snapshots := strings.Split(strings.TrimSpace(readTestFile(t, filepath.Join(config.OutDirectory, fmt.Sprintf("SPY-snapshot-%s.csv", day)))), "\n")
+
+		assert.Equal(t, errConnectionClosed, err)
+		assert.Equal(t, 3, len(updates))
+		assert.Equal(t, depthHeader, updates[0])
+		assert.Contains(t, updates[1], ",2,NSDQ,279.4900,300,2019-02-26 17:21:59.123,279.5100,500,2019-02-26 17:21:59.654,52,T,T")
+		assert.Contains(t, updates[2], ",Z,ARCX,279.5000,200,2019-02-26 17:22:00.004,279.5200,100,2019-02-26 17:22:00.001,52,T,T")
+		assert.Equal(t, snapshotHeader, snapshots[0])
+		assert.True(t, len(snapshots) >= 1+2*3)
+		assert.Contains(t, snapshots[len(snapshots)-2], ",ARCX,279.5000,200,")
+		assert.Contains(t, snapshots[len(snapshots)-1], ",NSDQ,279.4900,300,")
+	})
+}
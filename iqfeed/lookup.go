@@ -0,0 +1,356 @@
+package iqfeed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// lookupMessage is the message id after the request id of lookup rows with protocol 6.1 and later
+const lookupMessage = "LS"
+
+// defaultSearches are the symbol searches of a universe without searches, every letter and digit and the
+// special characters IQFeed symbols start with, such as @ for futures and $ or . for indexes
+var defaultSearches = strings.Split("A,B,C,D,E,F,G,H,I,J,K,L,M,N,O,P,Q,R,S,T,U,V,W,X,Y,Z,0,1,2,3,4,5,6,7,8,9,@,#,$,.,+,-", ",")
+
+// ListedMarket is a market listing symbols, for example NYSE in the NYSE group or NGSM in the NASDAQ group
+type ListedMarket struct {
+	Id        string
+	ShortName string
+	LongName  string
+	GroupName string
+}
+
+// SecurityType is a type of security, for example EQUITY or FUTURE
+type SecurityType struct {
+	Id        string
+	ShortName string
+	LongName  string
+}
+
+// SymbolInfo is a symbol found by a symbol lookup
+type SymbolInfo struct {
+	Symbol      string
+	MarketId    string
+	TypeId      string
+	Description string
+}
+
+// Universe selects symbols by listed market and security type, optionally narrowed by symbol,
+// description, SIC or NAICS searches. Without searches every symbol of the markets and types is selected.
+type Universe struct {
+	// Markets are listed market or market group short names, for example NYSE or NASDAQ
+	Markets []string
+	// Types are security type short names, for example EQUITY or FUTURE
+	Types []string
+	// Searches are symbol searches
+	Searches []string
+	// Descriptions are description searches
+	Descriptions []string
+	// SIC and NAICS are industry code searches, matching codes starting with the value
+	SIC   []string
+	NAICS []string
+}
+
+// ParseUniverse parses space separated key=value terms with comma separated values, for example
+// "market=NYSE,NASDAQ type=EQUITY". The keys are market, type, search, description, sic and naics.
+func ParseUniverse(spec string) (Universe, error) {
+	universe := Universe{}
+
+	for _, term := range strings.Fields(spec) {
+		parts := strings.SplitN(term, "=", 2)
+
+		if len(parts) != 2 || parts[1] == "" {
+			return Universe{}, fmt.Errorf("incorrect universe term: %s", term)
+		}
+
+		values := strings.Split(parts[1], ",")
+
+		switch strings.ToLower(parts[0]) {
+		case "market":
+			universe.Markets = append(universe.Markets, values...)
+		case "type":
+			universe.Types = append(universe.Types, values...)
+		case "search":
+			universe.Searches = append(universe.Searches, values...)
+		case "description":
+			universe.Descriptions = append(universe.Descriptions, values...)
+		case "sic":
+			universe.SIC = append(universe.SIC, values...)
+		case "naics":
+			universe.NAICS = append(universe.NAICS, values...)
+		default:
+			return Universe{}, fmt.Errorf("unsupported universe key: %s", parts[0])
+		}
+	}
+
+	if len(universe.Markets) == 0 && len(universe.Types) == 0 && len(universe.Searches) == 0 &&
+		len(universe.Descriptions) == 0 && len(universe.SIC) == 0 && len(universe.NAICS) == 0 {
+		return Universe{}, fmt.Errorf("empty universe")
+	}
+
+	return universe, nil
+}
+
+// ListedMarkets requests the listed markets
+func (c *Client) ListedMarkets(ctx context.Context) ([]ListedMarket, error) {
+	rows, err := c.lookup(ctx, "SLM,%s")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var markets []ListedMarket
+
+	for _, row := range rows {
+		// Columns from IQFeed: requestId, id, shortName, longName, groupId, groupShortName
+		if len(row) < 6 {
+			return nil, errTooFewColumns
+		}
+
+		markets = append(markets, ListedMarket{Id: row[1], ShortName: row[2], LongName: row[3], GroupName: row[5]})
+	}
+
+	return markets, nil
+}
+
+// SecurityTypes requests the security types
+func (c *Client) SecurityTypes(ctx context.Context) ([]SecurityType, error) {
+	rows, err := c.lookup(ctx, "SST,%s")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var types []SecurityType
+
+	for _, row := range rows {
+		// Columns from IQFeed: requestId, id, shortName, longName
+		if len(row) < 4 {
+			return nil, errTooFewColumns
+		}
+
+		types = append(types, SecurityType{Id: row[1], ShortName: row[2], LongName: row[3]})
+	}
+
+	return types, nil
+}
+
+// Symbols looks up the symbols of the universe, sorted by symbol
+func (c *Client) Symbols(ctx context.Context, universe Universe) ([]SymbolInfo, error) {
+	var marketIds, typeIds map[string]bool
+
+	if len(universe.Markets) > 0 {
+		markets, err := c.ListedMarkets(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not request listed markets: %s", err)
+		}
+
+		marketIds, err = resolveMarkets(universe.Markets, markets)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(universe.Types) > 0 {
+		types, err := c.SecurityTypes(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not request security types: %s", err)
+		}
+
+		typeIds, err = resolveTypes(universe.Types, types)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	found := map[string]SymbolInfo{}
+
+	for _, request := range createSymbolRequests(universe, marketIds, typeIds) {
+		rows, err := c.lookup(ctx, request)
+
+		if err != nil {
+			return nil, fmt.Errorf("symbol lookup failed: %s", err)
+		}
+
+		for _, row := range rows {
+			info, err := parseSymbolInfo(request, row)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if (marketIds == nil || marketIds[info.MarketId]) && (typeIds == nil || typeIds[info.TypeId]) {
+				found[info.Symbol] = info
+			}
+		}
+	}
+
+	symbols := make([]SymbolInfo, 0, len(found))
+
+	for _, info := range found {
+		symbols = append(symbols, info)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Symbol < symbols[j].Symbol
+	})
+
+	return symbols, nil
+}
+
+// lookup sends a lookup request, formatted with the request id, and returns the data rows without the LS message id
+func (c *Client) lookup(ctx context.Context, request string) ([][]string, error) {
+	config := &Config{Protocol: NewProtocol, Host: c.Host, LookupPort: c.LookupPort}
+	createRequest := func(_ string, requestId string, _ *Config) string {
+		return fmt.Sprintf(request, requestId)
+	}
+
+	it, err := c.request(ctx, "", createRequest, config)
+
+	if err != nil {
+		return nil, err
+	}
+	defer it.close()
+
+	var rows [][]string
+
+	for it.next() {
+		row := it.row
+
+		if len(row) >= 2 && row[1] == lookupMessage {
+			row = append([]string{row[0]}, row[2:]...)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, it.err
+}
+
+// createSymbolRequests creates the SBF, SBS and SBN requests of the universe, with a %s placeholder for the request id.
+// The symbol and description searches are filtered on the security types, or on the markets without types.
+func createSymbolRequests(universe Universe, marketIds map[string]bool, typeIds map[string]bool) []string {
+	// SBF,[FieldToSearch],[SearchString],[FilterType],[FilterValue],[RequestID]<CR><LF>
+	filterType := ""
+	filterValue := ""
+
+	if typeIds != nil {
+		filterType = "t"
+		filterValue = joinIds(typeIds)
+	} else if marketIds != nil {
+		filterType = "e"
+		filterValue = joinIds(marketIds)
+	}
+
+	var requests []string
+	searches := universe.Searches
+
+	if len(searches) == 0 && len(universe.Descriptions) == 0 && len(universe.SIC) == 0 && len(universe.NAICS) == 0 {
+		searches = defaultSearches
+	}
+
+	for _, search := range searches {
+		requests = append(requests, fmt.Sprintf("SBF,s,%s,%s,%s,%%s", strings.ToUpper(search), filterType, filterValue))
+	}
+
+	for _, description := range universe.Descriptions {
+		requests = append(requests, fmt.Sprintf("SBF,d,%s,%s,%s,%%s", description, filterType, filterValue))
+	}
+
+	// SBS,[SearchString],[RequestID]<CR><LF> and SBN,[SearchString],[RequestID]<CR><LF>
+	for _, code := range universe.SIC {
+		requests = append(requests, fmt.Sprintf("SBS,%s,%%s", code))
+	}
+
+	for _, code := range universe.NAICS {
+		requests = append(requests, fmt.Sprintf("SBN,%s,%%s", code))
+	}
+
+	return requests
+}
+
+func parseSymbolInfo(request string, row []string) (SymbolInfo, error) {
+	// Columns from IQFeed:
+	// SBF:      requestId, symbol, marketId, typeId, description
+	// SBS, SBN: requestId, code, symbol, marketId, typeId, description
+	columns := row[1:]
+
+	if !strings.HasPrefix(request, "SBF") {
+		columns = row[2:]
+	}
+
+	if len(columns) < 4 {
+		return SymbolInfo{}, errTooFewColumns
+	}
+
+	return SymbolInfo{Symbol: columns[0], MarketId: columns[1], TypeId: columns[2], Description: columns[3]}, nil
+}
+
+// resolveMarkets returns the ids of the markets matching the names by short name or group name
+func resolveMarkets(names []string, markets []ListedMarket) (map[string]bool, error) {
+	ids := map[string]bool{}
+
+	for _, name := range names {
+		found := false
+
+		for _, market := range markets {
+			if strings.EqualFold(market.ShortName, name) || strings.EqualFold(market.GroupName, name) {
+				ids[market.Id] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown listed market: %s", name)
+		}
+	}
+
+	return ids, nil
+}
+
+// resolveTypes returns the ids of the security types matching the short names
+func resolveTypes(names []string, types []SecurityType) (map[string]bool, error) {
+	ids := map[string]bool{}
+
+	for _, name := range names {
+		found := false
+
+		for _, securityType := range types {
+			if strings.EqualFold(securityType.ShortName, name) {
+				ids[securityType.Id] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown security type: %s", name)
+		}
+	}
+
+	return ids, nil
+}
+
+// joinIds returns the ids space separated in numeric order
+func joinIds(ids map[string]bool) string {
+	values := make([]string, 0, len(ids))
+
+	for id := range ids {
+		values = append(values, id)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) < len(values[j])
+		}
+
+		return values[i] < values[j]
+	})
+
+	return strings.Join(values, " ")
+}
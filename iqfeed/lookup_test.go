@@ -0,0 +1,124 @@
+package iqfeed
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUniverse(t *testing.T) {
+	t.Run("markets and types", func(t *testing.T) {
+		universe, err := ParseUniverse("market=NYSE,NASDAQ  type=EQUITY")
+
+		assert.Equal(t, Universe{Markets: []string{"NYSE", "NASDAQ"}, Types: []string{"EQUITY"}}, universe)
+		assert.Nil(t, err)
+	})
+
+	t.Run("searches", func(t *testing.T) {
+		universe, err := ParseUniverse("search=@ES description=GOLD sic=2834 naics=3254,5112")
+
+		assert.Equal(t, Universe{Searches: []string{"@ES"}, Descriptions: []string{"GOLD"}, SIC: []string{"2834"}, NAICS: []string{"3254", "5112"}}, universe)
+		assert.Nil(t, err)
+	})
+
+	t.Run("incorrect term", func(t *testing.T) {
+		_, err := ParseUniverse("NYSE")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unsupported key", func(t *testing.T) {
+		_, err := ParseUniverse("exchange=NYSE")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := ParseUniverse(" ")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCreateSymbolRequests(t *testing.T) {
+	t.Run("symbol searches filtered on types", func(t *testing.T) {
+		requests := createSymbolRequests(Universe{Searches: []string{"spy"}}, map[string]bool{"7": true}, map[string]bool{"10": true, "1": true})
+
+		assert.Equal(t, []string{"SBF,s,SPY,t,1 10,%s"}, requests)
+	})
+
+	t.Run("default searches filtered on markets", func(t *testing.T) {
+		requests := createSymbolRequests(Universe{}, map[string]bool{"7": true}, nil)
+
+		assert.Equal(t, len(defaultSearches), len(requests))
+		assert.Equal(t, "SBF,s,A,e,7,%s", requests[0])
+		assert.Contains(t, requests, "SBF,s,$,e,7,%s")
+	})
+
+	t.Run("industry codes", func(t *testing.T) {
+		requests := createSymbolRequests(Universe{SIC: []string{"2834"}, NAICS: []string{"3254"}}, nil, nil)
+
+		assert.Equal(t, []string{"SBS,2834,%s", "SBN,3254,%s"}, requests)
+	})
+}
+
+func TestSymbolsIntegration(t *testing.T) {
+	handler := func(request iqfeedtest.Request) iqfeedtest.Response {
+		switch request.Command {
+		case "SLM":
+			return iqfeedtest.Response{Rows: []string{
+				"5,NGSM,Nasdaq Global Select Market,5,NASDAQ",
+				"7,NYSE,New York Stock Exchange,7,NYSE",
+				"34,CME,Chicago Mercantile Exchange,34,CME",
+			}}
+		case "SST":
+			return iqfeedtest.Response{Rows: []string{"1,EQUITY,Equity", "14,FUTURE,Future"}}
+		case "SBF":
+			return iqfeedtest.Response{Rows: []string{
+				"LS,AAPL,5,1,APPLE INC",
+				"LS,AA,7,1,ALCOA CORP",
+				"LS,ABC.ETF,7,2,NOT AN EQUITY",
+			}}
+		case "SBS":
+			return iqfeedtest.Response{Rows: []string{"2834,PFE,7,1,PFIZER INC"}}
+		}
+
+		return iqfeedtest.Response{Error: "!NO_DATA!"}
+	}
+
+	t.Run("markets and types", func(t *testing.T) {
+		server, config := startTestServer(t, handler)
+		client := &Client{Host: config.Host, LookupPort: config.LookupPort}
+
+		symbols, err := client.Symbols(context.Background(), Universe{Markets: []string{"nasdaq", "NYSE"}, Types: []string{"EQUITY"}, Searches: []string{"a"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []SymbolInfo{
+			{Symbol: "AA", MarketId: "7", TypeId: "1", Description: "ALCOA CORP"},
+			{Symbol: "AAPL", MarketId: "5", TypeId: "1", Description: "APPLE INC"},
+		}, symbols)
+		assert.Equal(t, "SBF,s,A,t,1,"+server.Requests()[2].RequestId, strings.Join(server.Requests()[2].Fields, ","))
+	})
+
+	t.Run("industry code", func(t *testing.T) {
+		_, config := startTestServer(t, handler)
+		client := &Client{Host: config.Host, LookupPort: config.LookupPort}
+
+		symbols, err := client.Symbols(context.Background(), Universe{SIC: []string{"2834"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []SymbolInfo{{Symbol: "PFE", MarketId: "7", TypeId: "1", Description: "PFIZER INC"}}, symbols)
+	})
+
+	t.Run("unknown market", func(t *testing.T) {
+		_, config := startTestServer(t, handler)
+		client := &Client{Host: config.Host, LookupPort: config.LookupPort}
+
+		_, err := client.Symbols(context.Background(), Universe{Markets: []string{"LSE"}})
+
+		assert.EqualError(t, err, "unknown listed market: LSE")
+	})
+}
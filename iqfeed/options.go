@@ -0,0 +1,279 @@
+package iqfeed
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	OptionCalls = "c"
+	OptionPuts  = "p"
+	OptionBoth  = "pc"
+
+	// equityOptionMonths are the expiry month codes of calls, A to L, and puts, M to X
+	equityOptionMonths = "ABCDEFGHIJKLMNOPQRSTUVWX"
+	chainHeader        = "symbol,underlying,type,expiry,strike"
+)
+
+var (
+	// Equity options are root, year, day, month code and strike, for example AAPL1917A150 or SPY1918C262.5
+	equityOptionPattern = regexp.MustCompile(`^(.+?)(\d{2})(\d{2})([A-X])(\d+(?:\.\d+)?)$`)
+	// Futures options are root, month code, year, C or P and strike, for example @ESH20C3000
+	futureOptionPattern = regexp.MustCompile(`^(.+?)([FGHJKMNQUVXZ])(\d{2})([CP])(\d+(?:\.\d+)?)$`)
+)
+
+// OptionContract is an option of an option chain. Futures options have the first day of the contract month as expiry.
+type OptionContract struct {
+	Symbol     string
+	Underlying string
+	Put        bool
+	Expiry     time.Time
+	Strike     float64
+}
+
+// ChainFilter selects the options of a chain, zero expiry dates and strikes leave that end of the range open
+type ChainFilter struct {
+	// Side is OptionCalls, OptionPuts or OptionBoth
+	Side       string
+	ExpiryFrom time.Time
+	ExpiryTo   time.Time
+	StrikeMin  float64
+	StrikeMax  float64
+}
+
+// EquityOptionChain requests the equity options of an underlying
+func (c *Client) EquityOptionChain(ctx context.Context, underlying string, filter ChainFilter) ([]OptionContract, error) {
+	// CEO,[Symbol],[Puts/Calls],[MonthCodes],[NearMonths],[BinaryOptionFilter],[FilterType],[FilterValueOne],[FilterValueTwo],[RequestID]<CR><LF>
+	filterType := "0"
+	minStrike := ""
+	maxStrike := ""
+
+	if filter.StrikeMin > 0 || filter.StrikeMax > 0 {
+		filterType = "1"
+		minStrike = strconv.FormatFloat(filter.StrikeMin, 'f', -1, 64)
+		maxStrike = "999999"
+
+		if filter.StrikeMax > 0 {
+			maxStrike = strconv.FormatFloat(filter.StrikeMax, 'f', -1, 64)
+		}
+	}
+
+	request := fmt.Sprintf("CEO,%s,%s,%s,,0,%s,%s,%s,%%s", strings.ToUpper(underlying), chainSide(filter), equityMonthCodes(filter),
+		filterType, minStrike, maxStrike)
+	return c.optionChain(ctx, underlying, request, filter)
+}
+
+// equityMonthCodes returns the call and put month codes of the months in the expiry range, or of every month
+// without an end of the range or when it covers a year
+func equityMonthCodes(filter ChainFilter) string {
+	months := map[time.Month]bool{}
+
+	if !filter.ExpiryTo.IsZero() {
+		from := filter.ExpiryFrom
+
+		if from.IsZero() {
+			from = time.Now()
+		}
+
+		month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		for !month.After(filter.ExpiryTo) && len(months) < 12 {
+			months[month.Month()] = true
+			month = month.AddDate(0, 1, 0)
+		}
+	}
+
+	calls := ""
+	puts := ""
+
+	for month := time.January; month <= time.December; month++ {
+		if len(months) == 0 || months[month] {
+			calls += string(equityOptionMonths[month-1])
+			puts += string(equityOptionMonths[month+11])
+		}
+	}
+
+	switch chainSide(filter) {
+	case OptionCalls:
+		return calls
+	case OptionPuts:
+		return puts
+	}
+
+	return calls + puts
+}
+
+// FutureOptionChain requests the options of a futures root, for example @ES, expiring in the years of the expiry
+// range or else this year and the next. The CFU request is not used, it looks up the futures contracts of a root
+// and not their options, see FuturesContracts for the contracts.
+func (c *Client) FutureOptionChain(ctx context.Context, root string, filter ChainFilter) ([]OptionContract, error) {
+	from := filter.ExpiryFrom
+	to := filter.ExpiryTo
+
+	if from.IsZero() {
+		from = time.Now()
+	}
+
+	if to.IsZero() || to.Year() < from.Year() {
+		to = from.AddDate(1, 0, 0)
+	}
+
+	// Years are requested by their last digit
+	years := ""
+
+	for year := from.Year(); year <= to.Year() && len(years) < 10; year++ {
+		years += strconv.Itoa(year % 10)
+	}
+
+	// CFO,[Symbol],[Puts/Calls],[MonthCodes],[Years],[NearMonths],[RequestID]<CR><LF>
+	request := fmt.Sprintf("CFO,%s,%s,%s,%s,,%%s", strings.ToUpper(root), chainSide(filter), FuturesMonths, years)
+	return c.optionChain(ctx, root, request, filter)
+}
+
+func (c *Client) optionChain(ctx context.Context, underlying string, request string, filter ChainFilter) ([]OptionContract, error) {
+	rows, err := c.lookup(ctx, request)
+
+	if err != nil {
+		return nil, fmt.Errorf("option chain lookup failed: %s", err)
+	}
+
+	var contracts []OptionContract
+
+	// The chain is sent as colon separated symbols
+	for _, row := range rows {
+		for _, symbol := range strings.Split(strings.Join(row[1:], ":"), ":") {
+			symbol = strings.TrimSpace(symbol)
+
+			if symbol == "" {
+				continue
+			}
+
+			contract, err := parseOptionSymbol(symbol)
+
+			if err != nil {
+				log.WithError(err).WithField("symbol", symbol).Warn("Skipped option symbol")
+				continue
+			}
+
+			contract.Underlying = strings.ToUpper(underlying)
+
+			if filter.matches(contract) {
+				contracts = append(contracts, contract)
+			}
+		}
+	}
+
+	return contracts, nil
+}
+
+// parseOptionSymbol parses the side, expiry and strike of an equity or futures option symbol
+func parseOptionSymbol(symbol string) (OptionContract, error) {
+	if match := futureOptionPattern.FindStringSubmatch(symbol); match != nil {
+		year, _ := strconv.Atoi(match[3])
+		month := strings.IndexByte(FuturesMonths, match[2][0]) + 1
+		strike, err := strconv.ParseFloat(match[5], 64)
+
+		return OptionContract{
+			Symbol: symbol,
+			Put:    match[4] == "P",
+			Expiry: time.Date(2000+year, time.Month(month), 1, 0, 0, 0, 0, time.UTC),
+			Strike: strike,
+		}, err
+	}
+
+	if match := equityOptionPattern.FindStringSubmatch(symbol); match != nil {
+		year, _ := strconv.Atoi(match[2])
+		day, _ := strconv.Atoi(match[3])
+		code := strings.IndexByte(equityOptionMonths, match[4][0])
+		strike, err := strconv.ParseFloat(match[5], 64)
+
+		return OptionContract{
+			Symbol: symbol,
+			Put:    code >= 12,
+			Expiry: time.Date(2000+year, time.Month(code%12+1), day, 0, 0, 0, 0, time.UTC),
+			Strike: strike,
+		}, err
+	}
+
+	return OptionContract{}, fmt.Errorf("unknown option symbol: %s", symbol)
+}
+
+func (f ChainFilter) matches(contract OptionContract) bool {
+	if (f.Side == OptionCalls && contract.Put) || (f.Side == OptionPuts && !contract.Put) {
+		return false
+	}
+
+	if (!f.ExpiryFrom.IsZero() && contract.Expiry.Before(f.ExpiryFrom)) || (!f.ExpiryTo.IsZero() && contract.Expiry.After(f.ExpiryTo)) {
+		return false
+	}
+
+	return (f.StrikeMin <= 0 || contract.Strike >= f.StrikeMin) && (f.StrikeMax <= 0 || contract.Strike <= f.StrikeMax)
+}
+
+func chainSide(filter ChainFilter) string {
+	if filter.Side == "" {
+		return OptionBoth
+	}
+
+	return filter.Side
+}
+
+// WriteOptionChain writes the contracts to a chain manifest in the directory of the underlying in the output
+// directory, and returns the directory. The manifest is a CSV file when the output format is parquet.
+func WriteOptionChain(underlying string, contracts []OptionContract, config *Config) (string, error) {
+	if config.Format == ParquetFormat {
+		textConfig := *config
+		textConfig.Format = CSVFormat
+		config = &textConfig
+	}
+
+	directory := filepath.Join(config.OutDirectory, strings.ToUpper(underlying))
+	err := os.MkdirAll(directory, os.ModePerm)
+
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Create(filepath.Join(directory, getFilename("chain", config)))
+
+	if err != nil {
+		return "", fmt.Errorf("could not create file: %s", err)
+	}
+	defer file.Close()
+
+	writer := newTextWriter(file, config)
+	err = writer.writeHeader(chainHeader)
+
+	for _, contract := range contracts {
+		if err != nil {
+			break
+		}
+
+		side := "call"
+
+		if contract.Put {
+			side = "put"
+		}
+
+		err = writer.writeRow(joinColumns(config, contract.Symbol, contract.Underlying, side,
+			contract.Expiry.Format(dateFormat), strconv.FormatFloat(contract.Strike, 'f', -1, 64)))
+	}
+
+	if err == nil {
+		err = writer.flush()
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not write option chain: %s", err)
+	}
+
+	return directory, file.Close()
+}
@@ -0,0 +1,109 @@
+package iqfeed
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOptionSymbol(t *testing.T) {
+	t.Run("equity call", func(t *testing.T) {
+		contract, err := parseOptionSymbol("AAPL1917A150")
+
+		assert.Equal(t, OptionContract{Symbol: "AAPL1917A150", Expiry: time.Date(2019, 1, 17, 0, 0, 0, 0, time.UTC), Strike: 150}, contract)
+		assert.Nil(t, err)
+	})
+
+	t.Run("equity put with decimal strike", func(t *testing.T) {
+		contract, err := parseOptionSymbol("SPY1918X262.5")
+
+		assert.Equal(t, OptionContract{Symbol: "SPY1918X262.5", Put: true, Expiry: time.Date(2019, 12, 18, 0, 0, 0, 0, time.UTC), Strike: 262.5}, contract)
+		assert.Nil(t, err)
+	})
+
+	t.Run("futures option", func(t *testing.T) {
+		contract, err := parseOptionSymbol("@ESH20P3000")
+
+		assert.Equal(t, OptionContract{Symbol: "@ESH20P3000", Put: true, Expiry: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Strike: 3000}, contract)
+		assert.Nil(t, err)
+	})
+
+	t.Run("unknown symbol", func(t *testing.T) {
+		_, err := parseOptionSymbol("AAPL")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestEquityMonthCodes(t *testing.T) {
+	t.Run("expiry range across the year end", func(t *testing.T) {
+		filter := ChainFilter{ExpiryFrom: time.Date(2019, 11, 15, 0, 0, 0, 0, time.UTC), ExpiryTo: time.Date(2020, 2, 21, 0, 0, 0, 0, time.UTC)}
+
+		assert.Equal(t, "ABKLMNWX", equityMonthCodes(filter))
+	})
+
+	t.Run("puts of a range longer than a year", func(t *testing.T) {
+		filter := ChainFilter{Side: OptionPuts, ExpiryFrom: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), ExpiryTo: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+		assert.Equal(t, "MNOPQRSTUVWX", equityMonthCodes(filter))
+	})
+
+	t.Run("calls without end of range", func(t *testing.T) {
+		assert.Equal(t, "ABCDEFGHIJKL", equityMonthCodes(ChainFilter{Side: OptionCalls}))
+	})
+}
+
+func TestOptionChainIntegration(t *testing.T) {
+	handler := func(request iqfeedtest.Request) iqfeedtest.Response {
+		if request.Command == "CEO" {
+			return iqfeedtest.Response{Rows: []string{"AAPL1917A150:AAPL1917A200:AAPL1917M150:AAPL1915B150:"}}
+		}
+
+		return iqfeedtest.Response{Rows: []string{"LS,@ESH20C3000:@ESH20P3000:@ESH20-@ESM20:@ESM20C3000:"}}
+	}
+
+	t.Run("equity options filtered on side, expiry and strike", func(t *testing.T) {
+		server, config := startTestServer(t, handler)
+		client := &Client{Host: config.Host, LookupPort: config.LookupPort}
+		filter := ChainFilter{Side: OptionCalls, ExpiryFrom: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), ExpiryTo: time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC), StrikeMax: 180}
+
+		contracts, err := client.EquityOptionChain(context.Background(), "aapl", filter)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []OptionContract{{Symbol: "AAPL1917A150", Underlying: "AAPL", Expiry: time.Date(2019, 1, 17, 0, 0, 0, 0, time.UTC), Strike: 150}}, contracts)
+		assert.Equal(t, "CEO,AAPL,c,A,,0,1,0,180", strings.Join(server.Requests()[0].Fields[:9], ","))
+	})
+
+	t.Run("futures options skipping unknown symbols", func(t *testing.T) {
+		server, config := startTestServer(t, handler)
+		client := &Client{Host: config.Host, LookupPort: config.LookupPort}
+		filter := ChainFilter{ExpiryFrom: time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC), ExpiryTo: time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)}
+
+		contracts, err := client.FutureOptionChain(context.Background(), "@ES", filter)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(contracts))
+		assert.Equal(t, "CFO,@ES,pc,FGHJKMNQUVXZ,90,", strings.Join(server.Requests()[0].Fields[:6], ","))
+	})
+}
+
+func TestWriteOptionChain(t *testing.T) {
+	config := createConfig(0, "", false, false)
+	config.OutDirectory = t.TempDir()
+	contracts := []OptionContract{
+		{Symbol: "AAPL1917A150", Underlying: "AAPL", Expiry: time.Date(2019, 1, 17, 0, 0, 0, 0, time.UTC), Strike: 150},
+		{Symbol: "AAPL1917M152.5", Underlying: "AAPL", Put: true, Expiry: time.Date(2019, 1, 17, 0, 0, 0, 0, time.UTC), Strike: 152.5},
+	}
+
+	directory, err := WriteOptionChain("aapl", contracts, config)
+
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(config.OutDirectory, "AAPL"), directory)
+	assert.Equal(t, chainHeader+"\nAAPL1917A150,AAPL,call,2019-01-17,150\nAAPL1917M152.5,AAPL,put,2019-01-17,152.5\n",
+		readTestFile(t, filepath.Join(directory, "chain.csv")))
+}
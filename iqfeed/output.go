@@ -0,0 +1,110 @@
+package iqfeed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	CSVFormat     = "csv"
+	TSVFormat     = "tsv"
+	ParquetFormat = "parquet"
+)
+
+// outputWriter writes the header and mapped rows of a download to the output file
+type outputWriter interface {
+	writeHeader(header string) error
+	writeRow(row string) error
+	flush() error
+}
+
+// textWriter writes rows as CSV or TSV lines, optionally gzip compressed
+type textWriter struct {
+	writer *bufio.Writer
+	gzip   *gzip.Writer
+	output io.Writer
+	tsv    bool
+	dirty  bool
+}
+
+func newTextWriter(writer io.Writer, config *Config) *textWriter {
+	w := &textWriter{output: writer, tsv: config.TSV}
+
+	if config.Gzip {
+		w.gzip = gzip.NewWriter(writer)
+		writer = w.gzip
+	}
+
+	w.writer = bufio.NewWriterSize(writer, bufferSize)
+	return w
+}
+
+func (w *textWriter) writeHeader(header string) error {
+	if w.tsv {
+		header = strings.Replace(header, csvSeparator, tsvSeparator, -1)
+	}
+
+	w.dirty = true
+	_, err := fmt.Fprintln(w.writer, header)
+	return err
+}
+
+func (w *textWriter) writeRow(row string) error {
+	w.dirty = true
+	_, err := fmt.Fprintln(w.writer, row)
+	return err
+}
+
+// flush writes the buffered rows, gzip output is completed as a gzip member
+// and rows written after the flush start a new member. Flushes without new rows add no empty member.
+func (w *textWriter) flush() error {
+	err := w.writer.Flush()
+
+	if err != nil || w.gzip == nil || !w.dirty {
+		return err
+	}
+
+	w.dirty = false
+	err = w.gzip.Close()
+	w.gzip.Reset(w.output)
+	return err
+}
+
+// sync writes the buffered rows to the output without completing the gzip member
+func (w *textWriter) sync() error {
+	err := w.writer.Flush()
+
+	if err != nil || w.gzip == nil {
+		return err
+	}
+
+	return w.gzip.Flush()
+}
+
+// ValidateFormat checks the output format and its combination with the other options
+func ValidateFormat(config *Config) error {
+	config.Format = strings.ToLower(config.Format)
+
+	if config.TSV && config.Format == CSVFormat {
+		config.Format = TSVFormat
+	}
+
+	switch config.Format {
+	case CSVFormat:
+	case TSVFormat:
+		config.TSV = true
+	case ParquetFormat:
+		config.TSV = false
+
+		if config.Update {
+			return fmt.Errorf("update mode is not supported for parquet files")
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", config.Format)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package iqfeed
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	parquetDate      = "type=INT32, convertedtype=DATE"
+	parquetTimestamp = "type=INT64, convertedtype=TIMESTAMP_MICROS"
+	parquetDouble    = "type=DOUBLE"
+	parquetInt64     = "type=INT64"
+	parquetInt32     = "type=INT32"
+	parquetString    = "type=BYTE_ARRAY, convertedtype=UTF8"
+	parquetThreads   = 4
+)
+
+// Parquet column types of the output columns, all columns are optional to support empty values
+var parquetColumnTypes = map[string]string{
+	"date":       parquetDate,
+	"datetime":   parquetTimestamp,
+	"open":       parquetDouble,
+	"high":       parquetDouble,
+	"low":        parquetDouble,
+	"close":      parquetDouble,
+	"volume":     parquetInt64,
+	"oi":         parquetInt64,
+	"last":       parquetDouble,
+	"lastsize":   parquetInt64,
+	"totalsize":  parquetInt64,
+	"bid":        parquetDouble,
+	"ask":        parquetDouble,
+	"tickid":     parquetInt64,
+	"basis":      parquetString,
+	"market":     parquetInt32,
+	"cond":       parquetString,
+	"aggressor":  parquetInt32,
+	"daycode":    parquetInt32,
+	"adj_factor": parquetDouble,
+}
+
+// parquetWriter converts the mapped CSV rows to typed values and writes them as a Parquet file
+type parquetWriter struct {
+	writer   *writer.CSVWriter
+	columns  []string
+	location *time.Location
+}
+
+func newParquetWriter(header string, output io.Writer, location *time.Location, config *Config) (*parquetWriter, error) {
+	columns := strings.Split(header, csvSeparator)
+	metadata := make([]string, len(columns))
+
+	for i, column := range columns {
+		columnType, found := parquetColumnTypes[column]
+
+		if !found {
+			return nil, fmt.Errorf("unknown parquet column type: %s", column)
+		}
+
+		metadata[i] = fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", column, columnType)
+	}
+
+	csvWriter, err := writer.NewCSVWriterFromWriter(metadata, output, parquetThreads)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Gzip {
+		csvWriter.CompressionType = parquet.CompressionCodec_GZIP
+	}
+
+	return &parquetWriter{writer: csvWriter, columns: columns, location: location}, nil
+}
+
+// writeHeader does nothing since the column names are part of the Parquet schema
+func (w *parquetWriter) writeHeader(header string) error {
+	return nil
+}
+
+func (w *parquetWriter) writeRow(row string) error {
+	values := strings.Split(row, csvSeparator)
+
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("incorrect number of parquet columns: %d", len(values))
+	}
+
+	record := make([]interface{}, len(values))
+
+	for i, value := range values {
+		typedValue, err := w.parseValue(w.columns[i], value)
+
+		if err != nil {
+			return fmt.Errorf("could not convert %s value %q: %s", w.columns[i], value, err)
+		}
+
+		record[i] = typedValue
+	}
+
+	return w.writer.Write(record)
+}
+
+func (w *parquetWriter) parseValue(column string, value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	switch parquetColumnTypes[column] {
+	case parquetDate:
+		date, err := time.Parse(dateFormat, value)
+		if err != nil {
+			return nil, err
+		}
+		return int32(date.Unix() / int64(24*time.Hour/time.Second)), nil
+	case parquetTimestamp:
+		timestamp, err := parseTimestamp(value, w.location)
+		if err != nil {
+			return nil, err
+		}
+		return timestamp.UnixNano() / int64(time.Microsecond), nil
+	case parquetDouble:
+		return strconv.ParseFloat(value, 64)
+	case parquetInt64:
+		return strconv.ParseInt(value, 10, 64)
+	case parquetInt32:
+		number, err := strconv.ParseInt(value, 10, 32)
+		return int32(number), err
+	}
+
+	return value, nil
+}
+
+// flush writes the remaining row groups and the Parquet footer
+func (w *parquetWriter) flush() error {
+	return w.writer.WriteStop()
+}
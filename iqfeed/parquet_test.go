@@ -0,0 +1,65 @@
+package iqfeed
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetWriter(t *testing.T) {
+	t.Run("typed eod columns", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		writer, err := newParquetWriter("date,open,high,low,close,volume,oi", output, et, createConfig(0, "", false, false))
+		assert.Nil(t, err)
+
+		assert.Nil(t, writer.writeRow("2019-02-21,23.8700,24.0600,23.8038,24.0000,29183,"))
+		assert.Nil(t, writer.flush())
+
+		parquetReader, err := reader.NewParquetColumnReader(buffer.NewBufferFileFromBytes(output.Bytes()), 1)
+		assert.Nil(t, err)
+		dates, _, _, _ := parquetReader.ReadColumnByPath("parquet_go_root\x01date", 1)
+		closes, _, _, _ := parquetReader.ReadColumnByPath("parquet_go_root\x01close", 1)
+		volumes, _, _, _ := parquetReader.ReadColumnByPath("parquet_go_root\x01volume", 1)
+		openInterests, _, _, _ := parquetReader.ReadColumnByPath("parquet_go_root\x01oi", 1)
+
+		assert.Equal(t, int64(1), parquetReader.GetNumRows())
+		assert.Equal(t, []interface{}{int32(17948)}, dates)
+		assert.Equal(t, []interface{}{24.0}, closes)
+		assert.Equal(t, []interface{}{int64(29183)}, volumes)
+		assert.Equal(t, []interface{}{nil}, openInterests)
+	})
+
+	t.Run("tick timestamp in microseconds", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		writer, err := newParquetWriter("datetime,last,lastsize,totalsize,bid,ask,tickid,basis,market,cond", output, et, createConfig(0, "", false, false))
+		assert.Nil(t, err)
+
+		assert.Nil(t, writer.writeRow("2019-02-25 11:30:06.691,23.8800,12,6714,23.8700,23.9700,6,O,25,3D87"))
+		assert.Nil(t, writer.flush())
+
+		parquetReader, err := reader.NewParquetColumnReader(buffer.NewBufferFileFromBytes(output.Bytes()), 1)
+		assert.Nil(t, err)
+		timestamps, _, _, _ := parquetReader.ReadColumnByPath("parquet_go_root\x01datetime", 1)
+		conditions, _, _, _ := parquetReader.ReadColumnByPath("parquet_go_root\x01cond", 1)
+
+		assert.Equal(t, []interface{}{int64(1551112206691000)}, timestamps)
+		assert.Equal(t, []interface{}{"3D87"}, conditions)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		writer, _ := newParquetWriter("date,open,high,low,close,volume,oi", &bytes.Buffer{}, et, createConfig(0, "", false, false))
+
+		err := writer.writeRow("2019-02-21,x,24.0600,23.8038,24.0000,29183,0")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		_, err := newParquetWriter("date,unknown", &bytes.Buffer{}, et, createConfig(0, "", false, false))
+
+		assert.NotNil(t, err)
+	})
+}
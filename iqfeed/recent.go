@@ -0,0 +1,119 @@
+package iqfeed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValidateRecent checks that the most recent days or datapoints are requested instead of a date range
+func ValidateRecent(config *Config) error {
+	if config.Days == 0 && config.MaxPoints == 0 {
+		return nil
+	}
+
+	if config.Days < 0 {
+		return fmt.Errorf("incorrect number of days: %d", config.Days)
+	}
+
+	if config.MaxPoints < 0 {
+		return fmt.Errorf("incorrect number of datapoints: %d", config.MaxPoints)
+	}
+
+	switch strings.ToLower(config.Command) {
+	case "minute", "interval", "tick":
+	case "eod":
+		if config.Days > 0 && config.MaxPoints > 0 {
+			return fmt.Errorf("days and datapoints can only be combined for minute, interval and tick downloads")
+		}
+	case "weekly", "monthly":
+		if config.Days > 0 {
+			return fmt.Errorf("days are not supported for weekly and monthly bars, use datapoints instead")
+		}
+	default:
+		return fmt.Errorf("days and datapoints are not supported for %s", config.Command)
+	}
+
+	if config.StartDate != "" || config.EndDate != "" {
+		return fmt.Errorf("days and datapoints can not be combined with a start or end date")
+	}
+
+	// Appending the most recent days could leave a gap after the last update
+	if config.Update {
+		return fmt.Errorf("days and datapoints can not be updated, download them again instead")
+	}
+
+	return nil
+}
+
+// rangeOrRecent returns the request factory of the most recent days or datapoints when configured,
+// or else of the date range
+func rangeOrRecent(dateRange requestFactory, recent requestFactory, config *Config) requestFactory {
+	if config.Days > 0 || config.MaxPoints > 0 {
+		return recent
+	}
+
+	return dateRange
+}
+
+func createRecentEodRequest(symbol string, requestId string, config *Config) string {
+	// HDX,[Symbol],[MaxDatapoints],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+	// Every daily bar is a trading day, so the days are requested as datapoints
+	datapoints := config.MaxPoints
+
+	if config.Days > 0 {
+		datapoints = config.Days
+	}
+
+	return fmt.Sprintf("HDX,%s,%d,1,%s", strings.ToUpper(symbol), datapoints, requestId)
+}
+
+func createRecentMinuteRequest(symbol string, requestId string, config *Config) string {
+	recentConfig := *config
+	recentConfig.IntervalLength = 60
+	recentConfig.IntervalType = ""
+	recentConfig.UseLabels = false
+
+	return createRecentIntervalRequest(symbol, requestId, &recentConfig)
+}
+
+func createRecentIntervalRequest(symbol string, requestId string, config *Config) string {
+	// Minute bars are requested without interval type and label, like the HIT minute request
+	options := ""
+
+	if config.IntervalType != "" {
+		options = fmt.Sprintf(",,%s%s", config.IntervalType, intervalLabel(config))
+	}
+
+	if config.Days > 0 {
+		// HID,[Symbol],[Interval],[Days],[MaxDatapoints],[BeginFilterTime],[EndFilterTime],[DataDirection],[RequestID],[DatapointsPerSend],[IntervalType],[LabelAtBeginning]<CR><LF>
+		beginFilter, endFilter := sessionFilterTimes(config)
+		return fmt.Sprintf("HID,%s,%d,%d,%s,%s,%s,1,%s%s", strings.ToUpper(symbol), config.IntervalLength, config.Days,
+			maxDatapoints(config), beginFilter, endFilter, requestId, options)
+	}
+
+	// HIX,[Symbol],[Interval],[MaxDatapoints],[DataDirection],[RequestID],[DatapointsPerSend],[IntervalType],[LabelAtBeginning]<CR><LF>
+	return fmt.Sprintf("HIX,%s,%d,%s,1,%s%s", strings.ToUpper(symbol), config.IntervalLength, maxDatapoints(config),
+		requestId, options)
+}
+
+func createRecentTickRequest(symbol string, requestId string, config *Config) string {
+	if config.Days > 0 {
+		// HTD,[Symbol],[Days],[MaxDatapoints],[BeginFilterTime],[EndFilterTime],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+		beginFilter, endFilter := sessionFilterTimes(config)
+		return fmt.Sprintf("HTD,%s,%d,%s,%s,%s,1,%s", strings.ToUpper(symbol), config.Days, maxDatapoints(config),
+			beginFilter, endFilter, requestId)
+	}
+
+	// HTX,[Symbol],[MaxDatapoints],[DataDirection],[RequestID],[DatapointsPerSend]<CR><LF>
+	return fmt.Sprintf("HTX,%s,%s,1,%s", strings.ToUpper(symbol), maxDatapoints(config), requestId)
+}
+
+// maxDatapoints returns the MaxDatapoints request field, empty for all datapoints
+func maxDatapoints(config *Config) string {
+	if config.MaxPoints <= 0 {
+		return ""
+	}
+
+	return strconv.Itoa(config.MaxPoints)
+}
@@ -0,0 +1,114 @@
+package iqfeed
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func createRecentConfig(command string, days int, maxPoints int) *Config {
+	config := createConfig(0, "", false, false)
+	config.Command = command
+	config.StartDate = ""
+	config.EndDate = ""
+	config.Days = days
+	config.MaxPoints = maxPoints
+
+	return config
+}
+
+func TestValidateRecent(t *testing.T) {
+	t.Run("days and datapoints of ticks", func(t *testing.T) {
+		assert.Nil(t, ValidateRecent(createRecentConfig("tick", 5, 500)))
+	})
+
+	t.Run("days and datapoints of daily bars", func(t *testing.T) {
+		assert.NotNil(t, ValidateRecent(createRecentConfig("eod", 5, 500)))
+	})
+
+	t.Run("days of weekly bars", func(t *testing.T) {
+		assert.NotNil(t, ValidateRecent(createRecentConfig("weekly", 5, 0)))
+	})
+
+	t.Run("start date", func(t *testing.T) {
+		config := createRecentConfig("minute", 5, 0)
+		config.StartDate = "20190122"
+
+		assert.NotNil(t, ValidateRecent(config))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		config := createRecentConfig("minute", 5, 0)
+		config.Update = true
+
+		assert.NotNil(t, ValidateRecent(config))
+	})
+}
+
+func TestCreateRecentRequests(t *testing.T) {
+	t.Run("daily bars of days", func(t *testing.T) {
+		request := createRecentEodRequest("spy", "R91", createRecentConfig("eod", 5, 0))
+
+		assert.Equal(t, "HDX,SPY,5,1,R91", request)
+	})
+
+	t.Run("weekly bars of datapoints", func(t *testing.T) {
+		request := createWeeklyRequest("spy", "R91", createRecentConfig("weekly", 0, 52))
+
+		assert.Equal(t, "HWX,SPY,52,1,R91", request)
+	})
+
+	t.Run("minute bars of days in session", func(t *testing.T) {
+		config := createRecentConfig("minute", 5, 0)
+		config.Session = SessionRegular
+
+		request := createRecentMinuteRequest("spy", "R91", config)
+
+		assert.Equal(t, "HID,SPY,60,5,,093000,160000,1,R91", request)
+	})
+
+	t.Run("interval bars of datapoints", func(t *testing.T) {
+		config := createRecentConfig("interval", 0, 500)
+		config.IntervalLength = 1000
+		config.IntervalType = "v"
+		config.UseLabels = true
+
+		request := createRecentIntervalRequest("spy", "R91", config)
+
+		assert.Equal(t, "HIX,SPY,1000,500,1,R91,,v,1", request)
+	})
+
+	t.Run("ticks of days and datapoints", func(t *testing.T) {
+		request := createRecentTickRequest("spy", "R91", createRecentConfig("tick", 5, 500))
+
+		assert.Equal(t, "HTD,SPY,5,500,,,1,R91", request)
+	})
+
+	t.Run("ticks of datapoints", func(t *testing.T) {
+		request := createRecentTickRequest("spy", "R91", createRecentConfig("tick", 0, 500))
+
+		assert.Equal(t, "HTX,SPY,500,1,R91", request)
+	})
+}
+
+func TestRecentIntegration(t *testing.T) {
+	t.Run("most recent daily bars", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: testEodRows},
+		}))
+		config.Command = "eod"
+		config.StartDate = ""
+		config.EndDate = ""
+		config.MaxPoints = 2
+
+		result := DownloadEod(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, "HDX", server.Requests()[0].Command)
+		assert.Equal(t, "SPY", server.Requests()[0].Symbol)
+		assert.Equal(t, testEodFile, readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+	})
+}
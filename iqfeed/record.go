@@ -0,0 +1,156 @@
+package iqfeed
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	sentExtension     = ".sent"
+	receivedExtension = ".received"
+)
+
+// recorder copies the raw bytes sent and received on a connection to the recording files of a symbol
+type recorder struct {
+	sent     *os.File
+	received *os.File
+}
+
+// replay is the state of a connection reading a recording instead of a socket
+type replay struct {
+	requestId string
+}
+
+// recordingReader reads from the socket and copies the bytes to the recording of the connection, if any
+type recordingReader struct {
+	conn  net.Conn
+	owner *Conn
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+
+	if n > 0 && r.owner.recorder != nil {
+		_, _ = r.owner.recorder.received.Write(p[:n])
+	}
+
+	return n, err
+}
+
+// recordingWriter writes to the socket and copies the bytes to the recording of the connection, if any
+type recordingWriter struct {
+	conn  net.Conn
+	owner *Conn
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.owner.recorder != nil {
+		_, _ = w.owner.recorder.sent.Write(p)
+	}
+
+	return w.conn.Write(p)
+}
+
+// record starts copying the raw bytes of the connection to <symbol>.sent and <symbol>.received in the directory,
+// replacing the recording of a previous attempt, until the returned function is called
+func (c *Conn) record(directory string, symbol string) (stop func(), err error) {
+	base := filepath.Join(directory, strings.ToUpper(symbol))
+	sent, err := os.Create(base + sentExtension)
+
+	if err != nil {
+		return nil, err
+	}
+
+	received, err := os.Create(base + receivedExtension)
+
+	if err != nil {
+		_ = sent.Close()
+		return nil, err
+	}
+
+	c.recorder = &recorder{sent: sent, received: received}
+
+	// A reused connection set the protocol before the recording started, the exchange is repeated
+	// so the recording can be replayed on its own with the confirmed protocol
+	if c.conn != nil {
+		_, _ = fmt.Fprintf(sent, "S,SET PROTOCOL,%s\r\n", c.requested)
+
+		if c.protocol != "" {
+			_, _ = fmt.Fprintf(received, "S,CURRENT PROTOCOL,%s\r\n", c.protocol)
+		}
+	}
+
+	return func() {
+		c.recorder = nil
+		_ = sent.Close()
+		_ = received.Close()
+	}, nil
+}
+
+// openReplay returns a connection reading the received bytes recorded for the symbol in the directory,
+// the rows are replayed in order for the requests sent on the connection
+func openReplay(directory string, symbol string) (*Conn, error) {
+	path := filepath.Join(directory, strings.ToUpper(symbol)+receivedExtension)
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	connection := &Conn{replay: &replay{}}
+	connection.open(&replayConn{file: file})
+
+	return connection, nil
+}
+
+// replayConn is a net.Conn reading a recording, writes are discarded
+type replayConn struct {
+	file *os.File
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.file.Read(p)
+}
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (c *replayConn) Close() error {
+	return c.file.Close()
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return replayAddr(c.file.Name())
+}
+
+func (c *replayConn) RemoteAddr() net.Addr {
+	return replayAddr(c.file.Name())
+}
+
+func (c *replayConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// replayAddr is the path of a recording as network address
+type replayAddr string
+
+func (a replayAddr) Network() string {
+	return "file"
+}
+
+func (a replayAddr) String() string {
+	return string(a)
+}
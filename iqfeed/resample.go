@@ -0,0 +1,473 @@
+package iqfeed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	BarTime   = "time"
+	BarVolume = "volume"
+	BarTick   = "tick"
+	BarDollar = "dollar"
+	BarRange  = "range"
+
+	secondsPerDay = 24 * 60 * 60
+	// rangeTolerance keeps floating point errors from closing range bars early
+	rangeTolerance = 1e-9
+)
+
+// resampleTick is a trade of a tick file
+type resampleTick struct {
+	time  time.Time
+	last  string
+	price float64
+	size  int64
+}
+
+// resampledBar is a bar being built from ticks, the prices are kept as written in the tick file
+type resampledBar struct {
+	day     string
+	bucket  time.Time
+	first   time.Time
+	last    time.Time
+	open    string
+	high    string
+	low     string
+	close   string
+	highest float64
+	lowest  float64
+	volume  int64
+	dollars float64
+	ticks   int
+}
+
+// barBuilder groups ticks into bars of the bar type and size of the config
+type barBuilder struct {
+	config  *Config
+	session *session
+	current *resampledBar
+}
+
+// ValidateResample checks the bar type and size, and that resampled files are not written over the tick files
+func ValidateResample(config *Config) error {
+	config.BarType = strings.ToLower(config.BarType)
+
+	switch config.BarType {
+	case BarTime:
+		if config.BarSize != math.Trunc(config.BarSize) || config.BarSize > secondsPerDay {
+			return fmt.Errorf("time bars must be whole seconds up to a day: %v", config.BarSize)
+		}
+	case BarVolume, BarTick, BarDollar, BarRange:
+	default:
+		return fmt.Errorf("unsupported bar type: %s", config.BarType)
+	}
+
+	if config.BarSize <= 0 {
+		return fmt.Errorf("incorrect bar size: %v", config.BarSize)
+	}
+
+	if config.InDirectory == "" {
+		return fmt.Errorf("no tick file directory")
+	}
+
+	if filepath.Clean(config.InDirectory) == filepath.Clean(config.OutDirectory) {
+		return fmt.Errorf("resampled bars can not be written to the tick file directory")
+	}
+
+	if config.Update {
+		return fmt.Errorf("resampled bars can not be updated, resample them again instead")
+	}
+
+	if config.Session != "" {
+		_, err := parseSession(config.Session)
+		return err
+	}
+
+	return nil
+}
+
+// ResampleTicks builds bars from the tick file of a symbol in the input directory, as written by DownloadTicks,
+// into a file in the output directory with the columns of DownloadInterval. The connection is not used.
+func ResampleTicks(ctx context.Context, symbol string, _ *Conn, config *Config) (result DownloadResult) {
+	started := time.Now()
+	result = DownloadResult{Symbol: strings.ToUpper(symbol)}
+
+	logCtx := log.WithFields(log.Fields{
+		"symbol": strings.ToUpper(symbol),
+	})
+
+	location, err := LoadLocation(config.TimeZone)
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not load time zone")
+		return result.failed(err)
+	}
+
+	path := filepath.Join(config.OutDirectory, getFilename(symbol, config))
+
+	if fileExists(path) {
+		logCtx.Info("Already resampled")
+		result.Status = StatusSkipped
+		return result
+	}
+
+	inPath := findTickFile(config.InDirectory, symbol)
+
+	if inPath == "" {
+		err = fmt.Errorf("no tick file of %s in %s", strings.ToUpper(symbol), config.InDirectory)
+		logCtx.WithError(err).Error("Could not find tick file")
+		return result.failed(err)
+	}
+
+	builder := &barBuilder{config: config}
+
+	if config.Session != "" {
+		filter, err := parseSession(config.Session)
+
+		if err != nil {
+			return result.failed(err)
+		}
+
+		builder.session = &filter
+	}
+
+	logCtx.WithField("file", inPath).Info("Resampling")
+
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	of, err := os.Create(tmpPath)
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not create output file")
+		return result.failed(err)
+	}
+
+	successful := false
+
+	defer func() {
+		_ = of.Close()
+
+		if successful {
+			err = os.Rename(tmpPath, path)
+
+			if err != nil {
+				logCtx.WithError(err).Error("Rename temporary file to output file error")
+				result = result.failed(err)
+			}
+		} else {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	counter := &countingWriter{writer: of}
+	var writer outputWriter
+
+	if config.Format == ParquetFormat {
+		writer, err = newParquetWriter(intervalHeader, counter, location, config)
+	} else {
+		writer = newTextWriter(counter, config)
+	}
+
+	if err == nil {
+		err = writer.writeHeader(intervalHeader)
+	}
+
+	if err != nil {
+		logCtx.WithError(err).Error("Could not create output writer")
+		return result.failed(err)
+	}
+
+	rowCount := 0
+	write := func(bars ...*resampledBar) error {
+		for _, bar := range bars {
+			err := writer.writeRow(builder.format(bar))
+
+			if err != nil {
+				return err
+			}
+
+			rowCount++
+		}
+
+		return nil
+	}
+
+	err = readTicks(ctx, inPath, location, config, func(tick resampleTick) error {
+		return write(builder.add(tick)...)
+	})
+
+	if err == nil && builder.current != nil {
+		err = write(builder.current)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		logCtx.Info("Cancelled")
+		return result.cancelled(err)
+	} else if err != nil {
+		logCtx.WithError(err).Error("Resample error")
+		return result.failed(err)
+	}
+
+	if rowCount == 0 {
+		logCtx.Info("No data")
+		result.Status = StatusNoData
+		result.Duration = time.Since(started)
+		return result
+	}
+
+	err = writer.flush()
+
+	if err != nil {
+		logCtx.WithError(err).Error("Flush output file error")
+		return result.failed(err)
+	}
+
+	successful = true
+	result.Status = StatusSuccess
+	result.Rows = rowCount
+	result.Bytes = counter.count
+	result.Duration = time.Since(started)
+
+	logCtx.WithFields(log.Fields{
+		"duration": fmt.Sprintf("%dms", result.Duration.Milliseconds()),
+		"rows":     rowCount}).Info("Completed")
+
+	return result
+}
+
+// findTickFile returns the path of the CSV or TSV tick file of the symbol, gzipped or not, or an empty string
+func findTickFile(directory string, symbol string) string {
+	for _, name := range []string{symbol, strings.ToUpper(symbol)} {
+		for _, extension := range []string{".csv", ".csv.gz", ".tsv", ".tsv.gz"} {
+			path := filepath.Join(directory, name+extension)
+
+			if fileExists(path) {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
+
+// readTicks reads the trades of a tick file, the columns are found by the header names
+func readTicks(ctx context.Context, path string, location *time.Location, config *Config, handle func(resampleTick) error) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	}
+
+	separator := csvSeparator
+
+	if strings.HasSuffix(strings.TrimSuffix(path, ".gz"), ".tsv") {
+		separator = tsvSeparator
+	}
+
+	var timeColumn, lastColumn, sizeColumn int
+	var input *Config
+	header := false
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if line == "" {
+			continue
+		}
+
+		row := strings.Split(line, separator)
+
+		if !header {
+			timeColumn, lastColumn, sizeColumn = indexOf(row, "datetime"), indexOf(row, "last"), indexOf(row, "lastsize")
+
+			if timeColumn < 0 || lastColumn < 0 || sizeColumn < 0 {
+				return fmt.Errorf("not a tick file: %s", path)
+			}
+
+			header = true
+			continue
+		}
+
+		if len(row) <= timeColumn || len(row) <= lastColumn || len(row) <= sizeColumn {
+			return errTooFewColumns
+		}
+
+		if row[lastColumn] == "" {
+			continue
+		}
+
+		// The tick files may have been downloaded with another time format than the bars
+		if input == nil {
+			input = inputTimeFormat(row[timeColumn], config)
+		}
+
+		timestamp, err := parseFormattedTimestamp(row[timeColumn], location, input)
+
+		if err != nil {
+			return err
+		}
+
+		parser := fieldParser{}
+		tick := resampleTick{time: timestamp, last: row[lastColumn], price: parser.float(row[lastColumn]), size: parser.int(row[sizeColumn])}
+
+		if parser.err != nil {
+			return fmt.Errorf("could not parse tick: %s", parser.err)
+		}
+
+		err = handle(tick)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func indexOf(columns []string, name string) int {
+	for i, column := range columns {
+		if column == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// add adds a tick to the current bar and returns the bars completed by the tick. Bars never span trading days,
+// and ticks outside the session are skipped.
+func (b *barBuilder) add(tick resampleTick) []*resampledBar {
+	if b.session != nil && !b.session.contains(tick.time, false) {
+		return nil
+	}
+
+	var completed []*resampledBar
+	day := tick.time.Format(dateFormat)
+
+	if b.session != nil {
+		day = b.session.day(tick.time)
+	}
+
+	bucket := b.bucket(tick.time)
+
+	if b.current != nil && (b.current.day != day || !b.current.bucket.Equal(bucket) || b.exceedsRange(tick)) {
+		completed = append(completed, b.current)
+		b.current = nil
+	}
+
+	if b.current == nil {
+		b.current = &resampledBar{day: day, bucket: bucket, first: tick.time, open: tick.last, high: tick.last,
+			low: tick.last, highest: tick.price, lowest: tick.price}
+	}
+
+	bar := b.current
+	bar.last = tick.time
+	bar.close = tick.last
+	bar.volume += tick.size
+	bar.dollars += tick.price * float64(tick.size)
+	bar.ticks++
+
+	if tick.price > bar.highest {
+		bar.high = tick.last
+		bar.highest = tick.price
+	}
+
+	if tick.price < bar.lowest {
+		bar.low = tick.last
+		bar.lowest = tick.price
+	}
+
+	if b.full(bar) {
+		completed = append(completed, bar)
+		b.current = nil
+	}
+
+	return completed
+}
+
+// bucket returns the start of the time bar of the tick, counted in wall clock time from midnight so that
+// bars stay aligned across daylight saving time changes
+func (b *barBuilder) bucket(timestamp time.Time) time.Time {
+	if b.config.BarType != BarTime {
+		return time.Time{}
+	}
+
+	size := int(b.config.BarSize)
+	seconds := timestamp.Hour()*3600 + timestamp.Minute()*60 + timestamp.Second()
+	year, month, day := timestamp.Date()
+
+	return time.Date(year, month, day, 0, 0, seconds/size*size, 0, timestamp.Location())
+}
+
+func (b *barBuilder) exceedsRange(tick resampleTick) bool {
+	if b.config.BarType != BarRange {
+		return false
+	}
+
+	return math.Max(b.current.highest, tick.price)-math.Min(b.current.lowest, tick.price) > b.config.BarSize+rangeTolerance
+}
+
+func (b *barBuilder) full(bar *resampledBar) bool {
+	switch b.config.BarType {
+	case BarVolume:
+		return float64(bar.volume) >= b.config.BarSize
+	case BarTick:
+		return float64(bar.ticks) >= b.config.BarSize
+	case BarDollar:
+		return bar.dollars >= b.config.BarSize
+	}
+
+	return false
+}
+
+// format formats a bar like DownloadInterval, time bars are labeled with the start or end of the bar period
+// and the other bars with the time of their first or last tick
+func (b *barBuilder) format(bar *resampledBar) string {
+	var timestamp string
+
+	if b.config.BarType == BarTime {
+		label := bar.bucket
+
+		if b.config.EndTimestamp {
+			label = label.Add(time.Duration(b.config.BarSize) * time.Second)
+		}
+
+		timestamp = formatTimestamp(label, secondTimestampFormat, b.config)
+	} else if b.config.EndTimestamp {
+		timestamp = formatTimestamp(bar.last, millisecondTimestampFormat, b.config)
+	} else {
+		timestamp = formatTimestamp(bar.first, millisecondTimestampFormat, b.config)
+	}
+
+	return joinColumns(b.config, timestamp, bar.open, bar.high, bar.low, bar.close, strconv.FormatInt(bar.volume, 10))
+}
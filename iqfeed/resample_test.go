@@ -0,0 +1,172 @@
+package iqfeed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTickFile = "datetime,last,lastsize,totalsize,bid,ask,tickid,basis,market,cond\n" +
+	"2019-01-22 09:29:59.500,10.00,100,100,9.99,10.01,1,O,11,\n" +
+	"2019-01-22 09:30:00.100,10.10,200,300,10.09,10.11,2,C,11,\n" +
+	"2019-01-22 09:30:30.200,10.30,300,600,10.29,10.31,3,C,11,\n" +
+	"2019-01-22 09:30:59.900,10.20,100,700,10.19,10.21,4,C,11,\n" +
+	"2019-01-22 09:31:00.000,10.05,400,1100,10.04,10.06,5,C,11,\n" +
+	"2019-01-23 09:30:00.000,11.00,500,500,10.99,11.01,6,C,11,\n"
+
+func createResampleConfig(t *testing.T, barType string, barSize float64) *Config {
+	config := createConfig(0, "", false, false)
+	config.Command = "resample"
+	config.InDirectory = t.TempDir()
+	config.OutDirectory = t.TempDir()
+	config.BarType = barType
+	config.BarSize = barSize
+
+	_ = os.WriteFile(filepath.Join(config.InDirectory, "SPY.csv"), []byte(testTickFile), 0644)
+
+	return config
+}
+
+func TestValidateResample(t *testing.T) {
+	t.Run("valid options", func(t *testing.T) {
+		config := createResampleConfig(t, "Dollar", 100000)
+		config.Session = "09:30-16:00"
+
+		err := ValidateResample(config)
+
+		assert.Equal(t, BarDollar, config.BarType)
+		assert.Nil(t, err)
+	})
+
+	t.Run("fractional seconds", func(t *testing.T) {
+		assert.NotNil(t, ValidateResample(createResampleConfig(t, BarTime, 1.5)))
+	})
+
+	t.Run("unsupported bar type", func(t *testing.T) {
+		assert.NotNil(t, ValidateResample(createResampleConfig(t, "renko", 1)))
+	})
+
+	t.Run("tick file directory as output directory", func(t *testing.T) {
+		config := createResampleConfig(t, BarTick, 100)
+		config.OutDirectory = config.InDirectory + string(filepath.Separator)
+
+		assert.NotNil(t, ValidateResample(config))
+	})
+
+	t.Run("incorrect session", func(t *testing.T) {
+		config := createResampleConfig(t, BarTick, 100)
+		config.Session = "09:30"
+
+		assert.NotNil(t, ValidateResample(config))
+	})
+}
+
+func TestResampleTicks(t *testing.T) {
+	resample := func(t *testing.T, config *Config) string {
+		result := ResampleTicks(context.Background(), "spy", nil, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		return readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv"))
+	}
+
+	t.Run("time bars", func(t *testing.T) {
+		assert.Equal(t, intervalHeader+"\n"+
+			"2019-01-22 09:29:00,10.00,10.00,10.00,10.00,100\n"+
+			"2019-01-22 09:30:00,10.10,10.30,10.10,10.20,600\n"+
+			"2019-01-22 09:31:00,10.05,10.05,10.05,10.05,400\n"+
+			"2019-01-23 09:30:00,11.00,11.00,11.00,11.00,500\n",
+			resample(t, createResampleConfig(t, BarTime, 60)))
+	})
+
+	t.Run("time bars with end timestamps in session", func(t *testing.T) {
+		config := createResampleConfig(t, BarTime, 60)
+		config.EndTimestamp = true
+		config.Session = "09:30-09:31"
+
+		assert.Equal(t, intervalHeader+"\n"+
+			"2019-01-22 09:31:00,10.10,10.30,10.10,10.20,600\n"+
+			"2019-01-23 09:31:00,11.00,11.00,11.00,11.00,500\n",
+			resample(t, config))
+	})
+
+	t.Run("iqfeed ticks to epoch time bars", func(t *testing.T) {
+		config := createResampleConfig(t, BarTime, 60)
+		config.TimeFormat = TimeFormatEpochMillis
+
+		assert.Equal(t, intervalHeader+"\n"+
+			"1548167340000,10.00,10.00,10.00,10.00,100\n"+
+			"1548167400000,10.10,10.30,10.10,10.20,600\n"+
+			"1548167460000,10.05,10.05,10.05,10.05,400\n"+
+			"1548253800000,11.00,11.00,11.00,11.00,500\n",
+			resample(t, config))
+	})
+
+	t.Run("volume bars", func(t *testing.T) {
+		assert.Equal(t, intervalHeader+"\n"+
+			"2019-01-22 09:29:59.500,10.00,10.30,10.00,10.30,600\n"+
+			"2019-01-22 09:30:59.900,10.20,10.20,10.05,10.05,500\n"+
+			"2019-01-23 09:30:00.000,11.00,11.00,11.00,11.00,500\n",
+			resample(t, createResampleConfig(t, BarVolume, 500)))
+	})
+
+	t.Run("tick bars with end timestamps", func(t *testing.T) {
+		config := createResampleConfig(t, BarTick, 2)
+		config.EndTimestamp = true
+
+		assert.Equal(t, intervalHeader+"\n"+
+			"2019-01-22 09:30:00.100,10.00,10.10,10.00,10.10,300\n"+
+			"2019-01-22 09:30:59.900,10.30,10.30,10.20,10.20,400\n"+
+			"2019-01-22 09:31:00.000,10.05,10.05,10.05,10.05,400\n"+
+			"2019-01-23 09:30:00.000,11.00,11.00,11.00,11.00,500\n",
+			resample(t, config))
+	})
+
+	t.Run("dollar bars", func(t *testing.T) {
+		assert.Equal(t, intervalHeader+"\n"+
+			"2019-01-22 09:29:59.500,10.00,10.10,10.00,10.10,300\n"+
+			"2019-01-22 09:30:30.200,10.30,10.30,10.30,10.30,300\n"+
+			"2019-01-22 09:30:59.900,10.20,10.20,10.05,10.05,500\n"+
+			"2019-01-23 09:30:00.000,11.00,11.00,11.00,11.00,500\n",
+			resample(t, createResampleConfig(t, BarDollar, 3000)))
+	})
+
+	t.Run("range bars", func(t *testing.T) {
+		assert.Equal(t, intervalHeader+"\n"+
+			"2019-01-22 09:29:59.500,10.00,10.10,10.00,10.10,300\n"+
+			"2019-01-22 09:30:30.200,10.30,10.30,10.05,10.05,800\n"+
+			"2019-01-23 09:30:00.000,11.00,11.00,11.00,11.00,500\n",
+			resample(t, createResampleConfig(t, BarRange, 0.25)))
+	})
+
+	t.Run("gzipped tsv tick file", func(t *testing.T) {
+		config := createResampleConfig(t, BarTick, 10)
+		config.TSV = true
+		_ = os.Remove(filepath.Join(config.InDirectory, "SPY.csv"))
+
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		_, _ = writer.Write([]byte(strings.Replace(testTickFile, ",", "\t", -1)))
+		_ = writer.Close()
+		_ = os.WriteFile(filepath.Join(config.InDirectory, "spy.tsv.gz"), compressed.Bytes(), 0644)
+
+		result := ResampleTicks(context.Background(), "spy", nil, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, strings.Replace(intervalHeader, ",", "\t", -1)+"\n"+
+			"2019-01-22 09:29:59.500\t10.00\t10.30\t10.00\t10.05\t1100\n"+
+			"2019-01-23 09:30:00.000\t11.00\t11.00\t11.00\t11.00\t500\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "spy.tsv")))
+	})
+
+	t.Run("no tick file", func(t *testing.T) {
+		result := ResampleTicks(context.Background(), "qqq", nil, createResampleConfig(t, BarTick, 10))
+
+		assert.Equal(t, StatusFailed, result.Status)
+	})
+}
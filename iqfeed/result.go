@@ -0,0 +1,70 @@
+package iqfeed
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+type DownloadStatus string
+
+const (
+	StatusSuccess   DownloadStatus = "success"
+	StatusSkipped   DownloadStatus = "skipped"
+	StatusNoData    DownloadStatus = "no-data"
+	StatusFailed    DownloadStatus = "failed"
+	StatusCancelled DownloadStatus = "cancelled"
+)
+
+// DownloadResult is the outcome of downloading a symbol
+type DownloadResult struct {
+	Symbol   string
+	Status   DownloadStatus
+	Rows     int
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+}
+
+func (r DownloadResult) failed(err error) DownloadResult {
+	r.Status = StatusFailed
+	r.Rows = 0
+	r.Bytes = 0
+	r.Err = err
+	return r
+}
+
+func (r DownloadResult) cancelled(err error) DownloadResult {
+	r = r.failed(err)
+	r.Status = StatusCancelled
+	return r
+}
+
+// isNoData returns true when IQFeed has no data for the requested symbol and period
+func isNoData(err error) bool {
+	var iqfeedErr *iqfeedError
+	return errors.As(err, &iqfeedErr) && strings.Contains(iqfeedErr.message, "!NO_DATA!")
+}
+
+// isInvalidSymbol returns true when IQFeed does not know the requested symbol
+func isInvalidSymbol(err error) bool {
+	var iqfeedErr *iqfeedError
+	return errors.As(err, &iqfeedErr) && strings.Contains(strings.ToUpper(iqfeedErr.message), "INVALID SYMBOL")
+}
+
+// countingWriter counts the bytes written to the output file
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package iqfeed
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const maxRetryDelay = time.Minute
+
+// IQFeed error messages that will not change when the request is retried
+var permanentErrorMessages = []string{
+	"!NO_DATA!",
+	"INVALID SYMBOL",
+	"!SYNTAX_ERROR!",
+	"!INVALID_REQUEST!",
+	"UNAUTHORIZED",
+}
+
+// DownloadWithRetry downloads a symbol and retries transient errors with exponential backoff,
+// the duration of the returned result includes all attempts
+func DownloadWithRetry(ctx context.Context, symbol string, connection *Conn, config *Config, downloadFunc DownloadFunc) DownloadResult {
+	started := time.Now()
+
+	for attempt := 0; ; attempt++ {
+		result := downloadFunc(ctx, symbol, connection, config)
+
+		// Replayed recordings return the same rows every attempt and are not retried
+		if result.Err == nil || result.Status == StatusCancelled || attempt >= config.Retries || config.ReplayDirectory != "" || !isTransient(result.Err) {
+			result.Duration = time.Since(started)
+			return result
+		}
+
+		delay := retryDelay(attempt, config.RetryDelay)
+
+		log.WithFields(log.Fields{
+			"symbol":  strings.ToUpper(symbol),
+			"attempt": attempt + 1,
+			"delay":   delay.Round(time.Millisecond).String(),
+		}).Warn("Retrying")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			result = result.cancelled(ctx.Err())
+			result.Duration = time.Since(started)
+			return result
+		}
+	}
+}
+
+// isTransient returns true for errors that may succeed when retried, such as socket errors
+func isTransient(err error) bool {
+	var iqfeedErr *iqfeedError
+
+	if errors.As(err, &iqfeedErr) {
+		message := strings.ToUpper(iqfeedErr.message)
+
+		for _, permanentMessage := range permanentErrorMessages {
+			if strings.Contains(message, permanentMessage) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if errors.Is(err, errConnectionClosed) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryDelay doubles the base delay for every attempt and adds up to 50% random jitter
+func retryDelay(attempt int, baseDelay time.Duration) time.Duration {
+	if baseDelay <= 0 {
+		return 0
+	}
+
+	// Compare before shifting, since the shifted delay overflows for large attempts
+	delay := maxRetryDelay
+
+	if attempt < 63 && baseDelay <= maxRetryDelay>>uint(attempt) {
+		delay = baseDelay << uint(attempt)
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// streamWithReconnect runs streaming sessions until the context is done, reconnecting lost connections
+// with exponential backoff capped at the max retry delay. The retries are reset by a session that received data,
+// and are unlimited for a negative reconnect limit.
+func streamWithReconnect(ctx context.Context, config *Config, session func() (received bool, err error)) error {
+	failures := 0
+
+	for {
+		received, err := session()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if received {
+			failures = 0
+		}
+
+		if config.ReconnectLimit >= 0 && failures >= config.ReconnectLimit {
+			return err
+		}
+
+		delay := retryDelay(failures, config.RetryDelay)
+		failures++
+
+		log.WithError(err).WithField("delay", delay.Round(time.Millisecond).String()).Warn("Reconnecting")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package iqfeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	t.Run("no data", func(t *testing.T) {
+		assert.False(t, isTransient(&iqfeedError{message: "!NO_DATA!"}))
+	})
+
+	t.Run("invalid symbol", func(t *testing.T) {
+		assert.False(t, isTransient(&iqfeedError{message: "Invalid symbol."}))
+	})
+
+	t.Run("could not connect", func(t *testing.T) {
+		assert.True(t, isTransient(&iqfeedError{message: "Could not connect to History socket."}))
+	})
+
+	t.Run("connection closed", func(t *testing.T) {
+		assert.True(t, isTransient(fmt.Errorf("read: %w", errConnectionClosed)))
+	})
+
+	t.Run("socket error", func(t *testing.T) {
+		assert.True(t, isTransient(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}))
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		assert.False(t, isTransient(errors.New("map row error")))
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Run("first attempt", func(t *testing.T) {
+		delay := retryDelay(0, time.Second)
+
+		assert.True(t, delay >= time.Second && delay <= 1500*time.Millisecond)
+	})
+
+	t.Run("third attempt", func(t *testing.T) {
+		delay := retryDelay(2, time.Second)
+
+		assert.True(t, delay >= 4*time.Second && delay <= 6*time.Second)
+	})
+
+	t.Run("max delay", func(t *testing.T) {
+		delay := retryDelay(40, time.Second)
+
+		assert.True(t, delay >= maxRetryDelay && delay <= maxRetryDelay*3/2)
+	})
+
+	t.Run("overflowing attempt", func(t *testing.T) {
+		// Shifting the base delay wraps around to 16ms
+		delay := retryDelay(24, time.Duration(1)<<40+1)
+
+		assert.True(t, delay >= maxRetryDelay && delay <= maxRetryDelay*3/2)
+	})
+}
+
+func TestDownloadWithRetry(t *testing.T) {
+	t.Run("retries transient errors", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Retries = 2
+		attempts := 0
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, func(_ context.Context, symbol string, _ *Conn, _ *Config) DownloadResult {
+			attempts++
+			return DownloadResult{Symbol: symbol}.failed(errConnectionClosed)
+		})
+
+		assert.Equal(t, StatusFailed, result.Status)
+		assert.Equal(t, errConnectionClosed, result.Err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Retries = 2
+		attempts := 0
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, func(_ context.Context, symbol string, _ *Conn, _ *Config) DownloadResult {
+			attempts++
+			return DownloadResult{Symbol: symbol}.failed(&iqfeedError{message: "Invalid symbol."})
+		})
+
+		assert.Equal(t, StatusFailed, result.Status)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("returns successful result", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Retries = 2
+		attempts := 0
+
+		result := DownloadWithRetry(context.Background(), "spy", &Conn{}, config, func(_ context.Context, symbol string, _ *Conn, _ *Config) DownloadResult {
+			attempts++
+
+			if attempts == 1 {
+				return DownloadResult{Symbol: symbol}.failed(errConnectionClosed)
+			}
+
+			return DownloadResult{Symbol: symbol, Status: StatusSuccess, Rows: 10}
+		})
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, 10, result.Rows)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("stops retrying when cancelled", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Retries = 2
+		config.RetryDelay = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		attempts := 0
+
+		result := DownloadWithRetry(ctx, "spy", &Conn{}, config, func(_ context.Context, symbol string, _ *Conn, _ *Config) DownloadResult {
+			attempts++
+			cancel()
+			return DownloadResult{Symbol: symbol}.failed(errConnectionClosed)
+		})
+
+		assert.Equal(t, StatusCancelled, result.Status)
+		assert.Equal(t, context.Canceled, result.Err)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestStreamWithReconnect(t *testing.T) {
+	t.Run("reconnects until cancelled without limit", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.ReconnectLimit = -1
+		config.RetryDelay = 0
+		ctx, cancel := context.WithCancel(context.Background())
+		sessions := 0
+
+		err := streamWithReconnect(ctx, config, func() (bool, error) {
+			sessions++
+
+			if sessions == 10 {
+				cancel()
+			}
+
+			return false, errConnectionClosed
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 10, sessions)
+	})
+
+	t.Run("stops after consecutive failed reconnects", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.ReconnectLimit = 2
+		config.RetryDelay = 0
+		sessions := 0
+
+		err := streamWithReconnect(context.Background(), config, func() (bool, error) {
+			sessions++
+			return sessions == 2, errConnectionClosed
+		})
+
+		assert.Equal(t, errConnectionClosed, err)
+		assert.Equal(t, 4, sessions)
+	})
+}
@@ -0,0 +1,174 @@
+package iqfeed
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SessionRegular  = "rth"
+	SessionExtended = "eth"
+)
+
+// Trading sessions of US equities in Eastern Time, the time zone of the IQFeed filter times
+var namedSessions = map[string]string{
+	SessionRegular:  "09:30-16:00",
+	SessionExtended: "04:00-20:00",
+}
+
+// session is a daily time range in Eastern Time in seconds after midnight, from the start up to but not including
+// the end. Sessions ending before they start wrap midnight.
+type session struct {
+	start int
+	end   int
+}
+
+// ValidateSession checks the session and that it is used for intraday bars or ticks
+func ValidateSession(config *Config) error {
+	if config.Session == "" {
+		return nil
+	}
+
+	_, err := parseSession(config.Session)
+
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(config.Command) {
+	case "minute", "interval", "tick", "resample":
+		return nil
+	}
+
+	return fmt.Errorf("sessions are only supported for minute, interval, tick and resample")
+}
+
+// parseSession parses rth, eth or a custom HH:MM-HH:MM session, optionally prefixed by custom
+func parseSession(spec string) (session, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+
+	if named, found := namedSessions[spec]; found {
+		spec = named
+	}
+
+	parts := strings.Split(strings.TrimSpace(strings.TrimPrefix(spec, "custom")), "-")
+
+	if len(parts) != 2 {
+		return session{}, fmt.Errorf("incorrect session, expected rth, eth or HH:MM-HH:MM: %s", spec)
+	}
+
+	var bounds [2]int
+
+	for i, part := range parts {
+		clock, err := time.Parse("15:04", strings.TrimSpace(part))
+
+		if err != nil {
+			return session{}, fmt.Errorf("incorrect session time: %s", part)
+		}
+
+		bounds[i] = clock.Hour()*3600 + clock.Minute()*60
+	}
+
+	if bounds[0] == bounds[1] {
+		return session{}, fmt.Errorf("empty session: %s", spec)
+	}
+
+	return session{start: bounds[0], end: bounds[1]}, nil
+}
+
+// contains returns true for a time in the session, timestamps at the end of a bar are in the session when the
+// bar ends after the start and up to the end of the session
+func (s session) contains(timestamp time.Time, endLabel bool) bool {
+	seconds := secondsOfDay(timestamp.In(sourceLocation))
+
+	if endLabel {
+		// The bar ending at midnight ends the previous day
+		if seconds == 0 {
+			seconds = secondsPerDay
+		}
+
+		return s.containsSeconds(seconds - 1)
+	}
+
+	return s.containsSeconds(seconds)
+}
+
+func (s session) containsSeconds(seconds int) bool {
+	if s.start < s.end {
+		return seconds >= s.start && seconds < s.end
+	}
+
+	return seconds >= s.start || seconds < s.end
+}
+
+// day returns the trading day of a time in the session, sessions wrapping midnight belong to the day they end
+func (s session) day(timestamp time.Time) string {
+	timestamp = timestamp.In(sourceLocation)
+
+	if s.start > s.end && secondsOfDay(timestamp) >= s.start {
+		return timestamp.AddDate(0, 0, 1).Format(dateFormat)
+	}
+
+	return timestamp.Format(dateFormat)
+}
+
+// filterTimes returns the BeginFilterTime and EndFilterTime request fields, which are empty for sessions wrapping
+// midnight since IQFeed only filters times within a day
+func (s session) filterTimes() (string, string) {
+	if s.start > s.end {
+		return "", ""
+	}
+
+	format := func(seconds int) string {
+		return fmt.Sprintf("%02d%02d%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return format(s.start), format(s.end)
+}
+
+// sessionFilterTimes returns the request filter times of the session of the config, empty without a session
+func sessionFilterTimes(config *Config) (string, string) {
+	if config.Session == "" {
+		return "", ""
+	}
+
+	filter, err := parseSession(config.Session)
+
+	if err != nil {
+		return "", ""
+	}
+
+	return filter.filterTimes()
+}
+
+// filterSession skips the mapped rows outside the session. The timestamps are compared in Eastern Time after the
+// conversion to the target time zone, so the session is correct across daylight saving time changes and the bars
+// at the edges of the session that IQFeed includes are removed.
+func filterSession(mapper rowMapper, filter session) rowMapper {
+	return func(iqfeedRow []string, tz *time.Location, config *Config) (string, error) {
+		row, err := mapper(iqfeedRow, tz, config)
+
+		if err != nil || row == "" {
+			return row, err
+		}
+
+		timestamp, err := parseFormattedTimestamp(strings.SplitN(row, csvSeparator, 2)[0], tz, config)
+
+		if err != nil {
+			return "", err
+		}
+
+		endLabel := config.EndTimestamp && strings.ToLower(config.Command) != "tick"
+
+		if !filter.contains(timestamp, endLabel) {
+			return "", nil
+		}
+
+		return row, nil
+	}
+}
+
+func secondsOfDay(timestamp time.Time) int {
+	return timestamp.Hour()*3600 + timestamp.Minute()*60 + timestamp.Second()
+}
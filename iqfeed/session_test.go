@@ -0,0 +1,82 @@
+package iqfeed
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/nhedlund/qdownload/iqfeed/iqfeedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSession(t *testing.T) {
+	t.Run("regular trading hours of minute bars", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "minute"
+		config.Session = "RTH"
+
+		assert.Nil(t, ValidateSession(config))
+	})
+
+	t.Run("daily bars", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+		config.Session = SessionExtended
+
+		assert.NotNil(t, ValidateSession(config))
+	})
+
+	t.Run("incorrect session", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "tick"
+		config.Session = "09:30"
+
+		assert.NotNil(t, ValidateSession(config))
+	})
+}
+
+func TestSessionContains(t *testing.T) {
+	regular, _ := parseSession(SessionRegular)
+	overnight, err := parseSession("18:00-17:00")
+	assert.Nil(t, err)
+
+	open, _ := parseTimestamp("2019-01-22 09:30:00", et)
+	close, _ := parseTimestamp("2019-01-22 16:00:00", et)
+	evening, _ := parseTimestamp("2019-01-22 18:30:00", et)
+	afternoon, _ := parseTimestamp("2019-01-22 17:30:00", et)
+
+	assert.True(t, regular.contains(open, false))
+	assert.False(t, regular.contains(open, true))
+	assert.False(t, regular.contains(close, false))
+	assert.True(t, regular.contains(close, true))
+	assert.True(t, overnight.contains(evening, false))
+	assert.False(t, overnight.contains(afternoon, false))
+	assert.Equal(t, "2019-01-23", overnight.day(evening))
+}
+
+func TestSessionIntegration(t *testing.T) {
+	t.Run("minute bars in utc across daylight saving time", func(t *testing.T) {
+		server, config := startTestServer(t, iqfeedtest.Fixtures(map[string]iqfeedtest.Response{
+			"SPY": {Rows: []string{
+				"2019-03-08 09:30:00,1.0,1.0,1.0,1.0,100,100,1,",
+				"2019-03-08 09:31:00,2.0,2.0,2.0,2.0,200,100,1,",
+				"2019-03-08 16:00:00,3.0,3.0,3.0,3.0,300,100,1,",
+				"2019-03-08 16:01:00,4.0,4.0,4.0,4.0,400,100,1,",
+				"2019-03-11 09:31:00,5.0,5.0,5.0,5.0,500,100,1,",
+			}},
+		}))
+		config.Command = "minute"
+		config.Session = SessionRegular
+		config.TimeZone = "UTC"
+
+		result := DownloadMinute(context.Background(), "spy", &Conn{}, config)
+
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Equal(t, "093000", server.Requests()[0].Fields[6])
+		assert.Equal(t, "datetime,open,high,low,close,volume\n"+
+			"2019-03-08 14:30:00,2.0,2.0,2.0,2.0,100\n"+
+			"2019-03-08 20:59:00,3.0,3.0,3.0,3.0,100\n"+
+			"2019-03-11 13:30:00,5.0,5.0,5.0,5.0,100\n",
+			readTestFile(t, filepath.Join(config.OutDirectory, "spy.csv")))
+	})
+}
@@ -0,0 +1,150 @@
+package iqfeed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TimeFormatIQFeed       = "iqfeed"
+	TimeFormatISO8601      = "iso8601"
+	TimeFormatEpochSeconds = "epoch-s"
+	TimeFormatEpochMillis  = "epoch-ms"
+	TimeFormatEpochMicros  = "epoch-us"
+	TimeFormatEpochNanos   = "epoch-ns"
+)
+
+// Units of the epoch time formats
+var epochUnits = map[string]time.Duration{
+	TimeFormatEpochSeconds: time.Second,
+	TimeFormatEpochMillis:  time.Millisecond,
+	TimeFormatEpochMicros:  time.Microsecond,
+	TimeFormatEpochNanos:   time.Nanosecond,
+}
+
+// ValidateTimeFormat checks that the time format is a named format or a custom Go layout
+func ValidateTimeFormat(config *Config) error {
+	named := strings.ToLower(config.TimeFormat)
+
+	if _, epoch := epochUnits[named]; epoch || named == "" || named == TimeFormatIQFeed || named == TimeFormatISO8601 {
+		config.TimeFormat = named
+	} else if strings.Contains(config.TimeFormat, csvSeparator) || strings.Contains(config.TimeFormat, tsvSeparator) {
+		return fmt.Errorf("time format can not contain a column separator: %s", config.TimeFormat)
+	} else if reference := time.Date(2019, 1, 22, 9, 30, 15, 0, time.UTC); reference.Format(config.TimeFormat) == config.TimeFormat {
+		return fmt.Errorf("unknown time format: %s", config.TimeFormat)
+	}
+
+	if config.TimeFormat != "" && config.TimeFormat != TimeFormatIQFeed && config.Format == ParquetFormat {
+		return fmt.Errorf("time formats are not supported for parquet files, which store typed timestamps")
+	}
+
+	return nil
+}
+
+// formatTimestamp formats a timestamp with the time format of the config, the iqfeed format uses the date,
+// second or millisecond layout of the column and ISO 8601 timestamps have the same precision
+func formatTimestamp(timestamp time.Time, layout string, config *Config) string {
+	if unit, epoch := epochUnits[config.TimeFormat]; epoch {
+		return strconv.FormatInt(timestamp.UnixNano()/int64(unit), 10)
+	}
+
+	switch config.TimeFormat {
+	case "", TimeFormatIQFeed:
+		return timestamp.Format(layout)
+	case TimeFormatISO8601:
+		if layout == dateFormat {
+			layout = secondTimestampFormat
+		}
+
+		return timestamp.Format(strings.Replace(layout, " ", "T", 1) + "Z07:00")
+	}
+
+	return timestamp.Format(config.TimeFormat)
+}
+
+// formatDate formats the date of a daily bar, other time formats than iqfeed give the start of the day in the
+// time zone of the output
+func formatDate(date string, location *time.Location, config *Config) (string, error) {
+	if config.TimeFormat == "" || config.TimeFormat == TimeFormatIQFeed {
+		return date, nil
+	}
+
+	if len(date) > len(dateFormat) {
+		date = date[:len(dateFormat)]
+	}
+
+	day, err := time.ParseInLocation(dateFormat, date, location)
+
+	if err != nil {
+		return "", fmt.Errorf("could not parse date: %s", err)
+	}
+
+	return formatTimestamp(day, dateFormat, config), nil
+}
+
+// parseFormattedTimestamp parses a timestamp written with the time format of the config
+func parseFormattedTimestamp(value string, location *time.Location, config *Config) (time.Time, error) {
+	if unit, epoch := epochUnits[config.TimeFormat]; epoch {
+		number, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not parse epoch timestamp: %s", err)
+		}
+
+		return time.Unix(0, number*int64(unit)).In(location), nil
+	}
+
+	var timestamp time.Time
+	var err error
+
+	switch config.TimeFormat {
+	case "", TimeFormatIQFeed:
+		return parseTimestamp(value, location)
+	case TimeFormatISO8601:
+		timestamp, err = time.Parse(time.RFC3339Nano, value)
+	default:
+		timestamp, err = time.ParseInLocation(config.TimeFormat, value, location)
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse row timestamp: %s", err)
+	}
+
+	return timestamp.In(location), nil
+}
+
+// inputTimeFormat returns a copy of the config with the time format of a timestamp read from an input file, which
+// may have been written with another time format than the output. A custom layout is only detected when it is the
+// configured time format.
+func inputTimeFormat(value string, config *Config) *Config {
+	input := *config
+
+	// Epoch timestamps of every unit parse as an epoch time format, so their unit is detected from the digits
+	if _, epoch := epochUnits[config.TimeFormat]; !epoch {
+		if _, err := parseFormattedTimestamp(value, time.UTC, config); err == nil {
+			return &input
+		}
+	}
+
+	if _, err := parseTimestamp(value, time.UTC); err == nil {
+		input.TimeFormat = TimeFormatIQFeed
+	} else if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		input.TimeFormat = TimeFormatISO8601
+	} else if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Epoch seconds have 10 digits since 2001, and every smaller unit 3 more digits
+		switch digits := len(strings.TrimPrefix(value, "-")); {
+		case digits <= 11:
+			input.TimeFormat = TimeFormatEpochSeconds
+		case digits <= 14:
+			input.TimeFormat = TimeFormatEpochMillis
+		case digits <= 17:
+			input.TimeFormat = TimeFormatEpochMicros
+		default:
+			input.TimeFormat = TimeFormatEpochNanos
+		}
+	}
+
+	return &input
+}
@@ -0,0 +1,112 @@
+package iqfeed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTimeFormat(t *testing.T) {
+	t.Run("named format", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = "EPOCH-NS"
+
+		err := ValidateTimeFormat(config)
+
+		assert.Equal(t, TimeFormatEpochNanos, config.TimeFormat)
+		assert.Nil(t, err)
+	})
+
+	t.Run("custom layout", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = "01/02/2006 15:04:05"
+
+		assert.Nil(t, ValidateTimeFormat(config))
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = "unix"
+
+		assert.NotNil(t, ValidateTimeFormat(config))
+	})
+
+	t.Run("layout with column separator", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = "Jan 2, 2006"
+
+		assert.NotNil(t, ValidateTimeFormat(config))
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Format = ParquetFormat
+		config.TimeFormat = TimeFormatISO8601
+
+		assert.NotNil(t, ValidateTimeFormat(config))
+	})
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	// The first and second 01:30 of the daylight saving time fall-back hour
+	first := time.Date(2019, 11, 3, 5, 30, 0, 0, time.UTC).In(et)
+	second := first.Add(time.Hour)
+
+	format := func(timestamp time.Time, layout string, timeFormat string) string {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = timeFormat
+		return formatTimestamp(timestamp, layout, config)
+	}
+
+	assert.Equal(t, "2019-11-03 01:30:00", format(first, secondTimestampFormat, TimeFormatIQFeed))
+	assert.Equal(t, "2019-11-03 01:30:00", format(second, secondTimestampFormat, TimeFormatIQFeed))
+	assert.Equal(t, "2019-11-03T01:30:00-04:00", format(first, secondTimestampFormat, TimeFormatISO8601))
+	assert.Equal(t, "2019-11-03T01:30:00-05:00", format(second, secondTimestampFormat, TimeFormatISO8601))
+	assert.Equal(t, "2019-11-03T01:30:00.000-05:00", format(second, millisecondTimestampFormat, TimeFormatISO8601))
+	assert.Equal(t, "1572759000", format(first, secondTimestampFormat, TimeFormatEpochSeconds))
+	assert.Equal(t, "1572762600000000000", format(second, secondTimestampFormat, TimeFormatEpochNanos))
+	assert.Equal(t, "11/03 01:30 EST", format(second, secondTimestampFormat, "01/02 15:04 MST"))
+}
+
+func TestParseFormattedTimestamp(t *testing.T) {
+	timestamp := time.Date(2019, 2, 25, 11, 30, 6, 691000000, et)
+
+	for _, timeFormat := range []string{TimeFormatIQFeed, TimeFormatISO8601, TimeFormatEpochMillis, TimeFormatEpochMicros, "2006-01-02T15:04:05.000"} {
+		t.Run(timeFormat, func(t *testing.T) {
+			config := createConfig(0, "", false, false)
+			config.TimeFormat = timeFormat
+
+			parsed, err := parseFormattedTimestamp(formatTimestamp(timestamp, millisecondTimestampFormat, config), et, config)
+
+			assert.True(t, timestamp.Equal(parsed))
+			assert.Equal(t, et, parsed.Location())
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestInputTimeFormat(t *testing.T) {
+	timestamp := time.Date(2019, 2, 25, 11, 30, 6, 691000000, et)
+
+	for _, timeFormat := range []string{TimeFormatIQFeed, TimeFormatISO8601, TimeFormatEpochSeconds, TimeFormatEpochMillis, TimeFormatEpochMicros, TimeFormatEpochNanos} {
+		t.Run(timeFormat, func(t *testing.T) {
+			written := createConfig(0, "", false, false)
+			written.TimeFormat = timeFormat
+			config := createConfig(0, "", false, false)
+			config.TimeFormat = TimeFormatEpochMillis
+
+			input := inputTimeFormat(formatTimestamp(timestamp, millisecondTimestampFormat, written), config)
+
+			assert.Equal(t, timeFormat, input.TimeFormat)
+			assert.Equal(t, TimeFormatEpochMillis, config.TimeFormat)
+		})
+	}
+
+	t.Run("configured custom layout", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = "20060102 150405"
+
+		assert.Equal(t, "20060102 150405", inputTimeFormat("20190225 113006", config).TimeFormat)
+	})
+}
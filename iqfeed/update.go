@@ -0,0 +1,157 @@
+package iqfeed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	dateFormat         = "2006-01-02"
+	requestDateFormat  = "20060102"
+	requestTimeFormat  = "20060102 150405"
+	lastRowSearchBytes = 64 * 1024
+)
+
+// ValidateUpdate checks that the last row of an updated file is complete
+func ValidateUpdate(config *Config) error {
+	// The last weekly or monthly bar is usually of the current period and would be kept incomplete
+	if config.Update && (strings.ToLower(config.Command) == "weekly" || strings.ToLower(config.Command) == "monthly") {
+		return fmt.Errorf("weekly and monthly bars can not be updated, download them again instead")
+	}
+
+	return nil
+}
+
+// readLastTimestamp returns the timestamp of the last row in an existing output file,
+// or a zero time if the file only contains a header
+func readLastTimestamp(path string, targetLocation *time.Location, config *Config) (time.Time, error) {
+	lastRow, err := readLastRow(path, config.Gzip)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if lastRow == "" || strings.HasPrefix(lastRow, "date") {
+		return time.Time{}, nil
+	}
+
+	return parseRowTimestamp(lastRow, targetLocation, config)
+}
+
+func readLastRow(path string, gzipped bool) (string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if gzipped {
+		// Compressed files have to be read from the start
+		gzipReader, err := gzip.NewReader(file)
+
+		if err != nil {
+			return "", err
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	} else {
+		// Uncompressed files only need the last part of the file to be read
+		info, err := file.Stat()
+
+		if err != nil {
+			return "", err
+		}
+
+		if info.Size() > lastRowSearchBytes {
+			_, err = file.Seek(-lastRowSearchBytes, io.SeekEnd)
+
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	lastRow := ""
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, lastRowSearchBytes), lastRowSearchBytes)
+
+	for scanner.Scan() {
+		row := strings.TrimRight(scanner.Text(), "\r")
+
+		if row != "" {
+			lastRow = row
+		}
+	}
+
+	return lastRow, scanner.Err()
+}
+
+// parseRowTimestamp parses the date or datetime in the first column of an output row
+func parseRowTimestamp(row string, targetLocation *time.Location, config *Config) (time.Time, error) {
+	separator := csvSeparator
+
+	if config.TSV {
+		separator = tsvSeparator
+	}
+
+	value := strings.SplitN(row, separator, 2)[0]
+	return parseFormattedTimestamp(value, targetLocation, config)
+}
+
+// parseTimestamp parses a date, second or millisecond timestamp as written to the output files
+func parseTimestamp(value string, location *time.Location) (time.Time, error) {
+	layout := millisecondTimestampFormat
+
+	switch len(value) {
+	case len(dateFormat):
+		layout = dateFormat
+	case len(secondTimestampFormat):
+		layout = secondTimestampFormat
+	case len(microsecondTimestampFormat):
+		layout = microsecondTimestampFormat
+	}
+
+	timestamp, err := time.ParseInLocation(layout, value, location)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse row timestamp: %s", err)
+	}
+
+	return timestamp, nil
+}
+
+// updateConfig returns a copy of the config with the start date moved to the last downloaded timestamp,
+// rows up to and including the last timestamp are skipped when downloading
+func updateConfig(lastTimestamp time.Time, config *Config) *Config {
+	updated := *config
+
+	switch strings.ToLower(config.Command) {
+	case "eod", "weekly", "monthly":
+		updated.StartDate = lastTimestamp.Format(requestDateFormat)
+	default:
+		updated.StartDate = lastTimestamp.In(sourceLocation).Format(requestTimeFormat)
+	}
+
+	return &updated
+}
+
+func copyFile(path string, writer io.Writer) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(writer, file)
+	return err
+}
@@ -0,0 +1,140 @@
+package iqfeed
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUpdate(t *testing.T) {
+	t.Run("update of daily bars", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+		config.Update = true
+
+		assert.Nil(t, ValidateUpdate(config))
+	})
+
+	t.Run("update of weekly bars", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "weekly"
+		config.Update = true
+
+		assert.NotNil(t, ValidateUpdate(config))
+	})
+
+	t.Run("monthly bars without update", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "monthly"
+
+		assert.Nil(t, ValidateUpdate(config))
+	})
+}
+
+func TestReadLastRow(t *testing.T) {
+	t.Run("csv file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "SPY.csv")
+		content := "datetime,open,high,low,close,volume\n" +
+			"2019-02-26 12:20:00,23.8000,23.8000,23.8000,23.8000,100\n" +
+			"2019-02-26 12:21:00,23.8000,23.8000,23.8000,23.8000,100\n"
+		_ = os.WriteFile(path, []byte(content), 0644)
+
+		row, err := readLastRow(path, false)
+
+		assert.Equal(t, "2019-02-26 12:21:00,23.8000,23.8000,23.8000,23.8000,100", row)
+		assert.Nil(t, err)
+	})
+
+	t.Run("appended gzip file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "SPY.csv.gz")
+		file, _ := os.Create(path)
+		first := gzip.NewWriter(file)
+		_, _ = first.Write([]byte("date,open,high,low,close,volume,oi\n2019-02-20,1,1,1,1,1,0\n"))
+		_ = first.Close()
+		second := gzip.NewWriter(file)
+		_, _ = second.Write([]byte("2019-02-21,2,2,2,2,2,0\n"))
+		_ = second.Close()
+		_ = file.Close()
+
+		row, err := readLastRow(path, true)
+
+		assert.Equal(t, "2019-02-21,2,2,2,2,2,0", row)
+		assert.Nil(t, err)
+	})
+}
+
+func TestReadLastTimestamp(t *testing.T) {
+	t.Run("header only", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "SPY.csv")
+		_ = os.WriteFile(path, []byte("date,open,high,low,close,volume,oi\n"), 0644)
+
+		timestamp, err := readLastTimestamp(path, et, createConfig(0, "", false, false))
+
+		assert.True(t, timestamp.IsZero())
+		assert.Nil(t, err)
+	})
+}
+
+func TestParseRowTimestamp(t *testing.T) {
+	t.Run("date", func(t *testing.T) {
+		timestamp, err := parseRowTimestamp("2019-02-21,23.8700,24.0600,23.8038,24.0000,29183,0", et, createConfig(0, "", false, false))
+
+		assert.Equal(t, time.Date(2019, 2, 21, 0, 0, 0, 0, et), timestamp)
+		assert.Nil(t, err)
+	})
+
+	t.Run("millisecond timestamp in tsv", func(t *testing.T) {
+		timestamp, err := parseRowTimestamp("2019-02-25 11:30:06.691\t23.8800", et, createConfig(0, "", false, true))
+
+		assert.Equal(t, time.Date(2019, 2, 25, 11, 30, 6, 691000000, et), timestamp)
+		assert.Nil(t, err)
+	})
+
+	t.Run("microsecond timestamp", func(t *testing.T) {
+		timestamp, err := parseRowTimestamp("2019-02-25 11:30:06.691523,23.8800,12", et, createConfig(0, "", false, false))
+
+		assert.True(t, time.Date(2019, 2, 25, 11, 30, 6, 691523000, et).Equal(timestamp))
+		assert.Nil(t, err)
+	})
+
+	t.Run("epoch microseconds", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.TimeFormat = TimeFormatEpochMicros
+
+		timestamp, err := parseRowTimestamp("1551112206691000,23.8800", et, config)
+
+		assert.Equal(t, time.Date(2019, 2, 25, 11, 30, 6, 691000000, et), timestamp)
+		assert.Nil(t, err)
+	})
+
+	t.Run("invalid timestamp", func(t *testing.T) {
+		_, err := parseRowTimestamp("datetime,open", et, createConfig(0, "", false, false))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestUpdateConfig(t *testing.T) {
+	t.Run("eod start date", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "eod"
+
+		updated := updateConfig(time.Date(2019, 2, 21, 0, 0, 0, 0, et), config)
+
+		assert.Equal(t, "20190221", updated.StartDate)
+		assert.Equal(t, "20190122", config.StartDate)
+	})
+
+	t.Run("minute start time converted to source time zone", func(t *testing.T) {
+		config := createConfig(0, "", false, false)
+		config.Command = "minute"
+
+		updated := updateConfig(time.Date(2019, 2, 26, 17, 21, 0, 0, time.UTC), config)
+
+		assert.Equal(t, "20190226 122100", updated.StartDate)
+	})
+}
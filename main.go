@@ -2,54 +2,82 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/apex/log"
 	clilog "github.com/apex/log/handlers/cli"
 	"github.com/apex/log/handlers/text"
+	"github.com/nhedlund/qdownload/iqfeed"
 	"gopkg.in/urfave/cli.v1"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 type Config struct {
-	protocol        string
-	command         string
-	startDate       string
-	endDate         string
-	outDirectory    string
-	timeZone        string
-	intervalType    string
-	intervalLength  int
-	parallelism     int
-	tsv             bool
-	detailedLogging bool
-	gzip            bool
-	endTimestamp    bool
-	useLabels       bool
+	iqfeed.Config
+	parallelism int
+	report      string
+	universe    string
+	futuresBars string
 }
 
 var (
-	newProtocol = "6.0"
-
 	config = Config{
-		protocol:        "5.1",
-		command:         "",
-		startDate:       "",
-		endDate:         "",
-		outDirectory:    "data",
-		timeZone:        "ET",
-		intervalType:    "",
-		intervalLength:  0,
-		parallelism:     8,
-		tsv:             false,
-		detailedLogging: false,
-		gzip:            false,
-		endTimestamp:    false,
-		useLabels:       false,
+		Config: iqfeed.Config{
+			Protocol:        iqfeed.DefaultProtocol,
+			Command:         "",
+			StartDate:       "",
+			EndDate:         "",
+			OutDirectory:    "data",
+			TimeZone:        "ET",
+			IntervalType:    "",
+			IntervalLength:  0,
+			TSV:             false,
+			DetailedLogging: false,
+			Gzip:            false,
+			EndTimestamp:    false,
+			UseLabels:       false,
+			Update:          false,
+			Retries:         3,
+			ReconnectLimit:  -1,
+			RetryDelay:      time.Second,
+			Format:          iqfeed.CSVFormat,
+			Chunk:           "",
+			Host:            iqfeed.DefaultHost,
+			LookupPort:      iqfeed.DefaultLookupPort,
+			Level1Port:      iqfeed.DefaultLevel1Port,
+			DerivativePort:  iqfeed.DefaultDerivativePort,
+			Level2Port:      iqfeed.DefaultLevel2Port,
+			RecordDirectory: "",
+			ReplayDirectory: "",
+			Adjust:          "",
+			AdjustFactor:    false,
+			ContractMonths:  iqfeed.FuturesMonths,
+			Roll:            iqfeed.RollVolume,
+			RollDays:        5,
+			RollAdjustment:  iqfeed.RollAdjustNone,
+			InDirectory:     "",
+			BarType:         "",
+			BarSize:         0,
+			Session:         "",
+			Days:            0,
+			MaxPoints:       0,
+			TimeFormat:      iqfeed.TimeFormatIQFeed,
+		},
+		parallelism: 8,
+		report:      "",
+		universe:    "",
+		futuresBars: "eod",
 	}
+
+	// appContext is cancelled on SIGINT or SIGTERM to stop the running command
+	appContext = context.Background()
 )
 
 func detailedLoggingEnabled(args []string) bool {
@@ -66,6 +94,10 @@ func main() {
 	detailedLogging := detailedLoggingEnabled(os.Args)
 	setupLogging(detailedLogging)
 
+	var stop func()
+	appContext, stop = cancelOnSignal()
+	defer stop()
+
 	app := cli.NewApp()
 	app.Name = "qdownload"
 	app.Usage = "downloads historic market data from IQFeed"
@@ -78,25 +110,25 @@ func main() {
 			Name:        "start, s",
 			Value:       "",
 			Usage:       "start date filter: yyyymmdd",
-			Destination: &config.startDate,
+			Destination: &config.StartDate,
 		},
 		cli.StringFlag{
 			Name:        "end, e",
 			Value:       "",
 			Usage:       "end date filter: yyyymmdd",
-			Destination: &config.endDate,
+			Destination: &config.EndDate,
 		},
 		cli.StringFlag{
 			Name:        "out, o",
 			Value:       "data",
 			Usage:       "output directory",
-			Destination: &config.outDirectory,
+			Destination: &config.OutDirectory,
 		},
 		cli.StringFlag{
 			Name:        "timezone, z",
 			Value:       "ET",
 			Usage:       "timestamps time zone",
-			Destination: &config.timeZone,
+			Destination: &config.TimeZone,
 		},
 		cli.IntFlag{
 			Name:        "parallelism, p",
@@ -104,25 +136,152 @@ func main() {
 			Usage:       "number of parallel downloads",
 			Destination: &config.parallelism,
 		},
+		cli.StringFlag{
+			Name:        "format, f",
+			Value:       iqfeed.CSVFormat,
+			Usage:       "output format: csv, tsv or parquet",
+			Destination: &config.Format,
+		},
 		cli.BoolFlag{
 			Name:        "tsv, t",
 			Usage:       "use tab separator instead of comma",
-			Destination: &config.tsv,
+			Destination: &config.TSV,
 		},
 		cli.BoolFlag{
 			Name:        "detailed-logging, d",
 			Usage:       "detailed log output",
-			Destination: &config.detailedLogging,
+			Destination: &config.DetailedLogging,
 		},
 		cli.BoolFlag{
 			Name:        "gzip, g",
 			Usage:       "compress files with gzip",
-			Destination: &config.gzip,
+			Destination: &config.Gzip,
+		},
+		cli.StringFlag{
+			Name:        "time-format",
+			Value:       iqfeed.TimeFormatIQFeed,
+			Usage:       "timestamps format: iqfeed, iso8601, epoch-s, epoch-ms, epoch-us, epoch-ns or a Go layout",
+			Destination: &config.TimeFormat,
 		},
 		cli.BoolFlag{
 			Name:        "end-timestamp, m",
 			Usage:       "use end of bar timestamps instead of start",
-			Destination: &config.endTimestamp,
+			Destination: &config.EndTimestamp,
+		},
+		cli.BoolFlag{
+			Name:        "update, u",
+			Usage:       "append new data to already downloaded files",
+			Destination: &config.Update,
+		},
+		cli.StringFlag{
+			Name:        "chunk, c",
+			Value:       "",
+			Usage:       "split the date range into day, week or month requests, resumed from the last completed chunk on retry",
+			Destination: &config.Chunk,
+		},
+		cli.IntFlag{
+			Name:        "days",
+			Usage:       "download the most recent days instead of a date range",
+			Destination: &config.Days,
+		},
+		cli.IntFlag{
+			Name:        "max-points",
+			Usage:       "download at most the most recent datapoints, instead of a date range unless combined with --days",
+			Destination: &config.MaxPoints,
+		},
+		cli.StringFlag{
+			Name:        "session",
+			Value:       "",
+			Usage:       "only download or resample bars and ticks in the Eastern Time session: rth, eth or custom HH:MM-HH:MM",
+			Destination: &config.Session,
+		},
+		cli.StringFlag{
+			Name:        "adjust",
+			Value:       "",
+			Usage:       "back-adjust eod prices for splits, using the IQFeed fundamentals",
+			Destination: &config.Adjust,
+		},
+		cli.BoolFlag{
+			Name:        "adj-factor",
+			Usage:       "add an adj_factor column with the price adjustment factor of adjusted bars",
+			Destination: &config.AdjustFactor,
+		},
+		cli.IntFlag{
+			Name:        "retries, r",
+			Value:       3,
+			Usage:       "number of retries of failed downloads",
+			Destination: &config.Retries,
+		},
+		cli.IntFlag{
+			Name:        "reconnect-retries",
+			Value:       -1,
+			Usage:       "number of consecutive failed reconnects of streams before stopping, -1 for unlimited",
+			Destination: &config.ReconnectLimit,
+		},
+		cli.DurationFlag{
+			Name:        "retry-delay",
+			Value:       time.Second,
+			Usage:       "delay before the first retry, doubled for every retry",
+			Destination: &config.RetryDelay,
+		},
+		cli.StringFlag{
+			Name:        "host",
+			Value:       iqfeed.DefaultHost,
+			Usage:       "IQFeed client host",
+			EnvVar:      "IQFEED_HOST",
+			Destination: &config.Host,
+		},
+		cli.IntFlag{
+			Name:        "lookup-port",
+			Value:       iqfeed.DefaultLookupPort,
+			Usage:       "IQFeed historical lookup port",
+			EnvVar:      "IQFEED_LOOKUP_PORT",
+			Destination: &config.LookupPort,
+		},
+		cli.IntFlag{
+			Name:        "level1-port",
+			Value:       iqfeed.DefaultLevel1Port,
+			Usage:       "IQFeed Level 1 port used by stream, fundamentals and adjust",
+			EnvVar:      "IQFEED_LEVEL1_PORT",
+			Destination: &config.Level1Port,
+		},
+		cli.IntFlag{
+			Name:        "level2-port",
+			Value:       iqfeed.DefaultLevel2Port,
+			Usage:       "IQFeed Level 2 port used by depth",
+			EnvVar:      "IQFEED_LEVEL2_PORT",
+			Destination: &config.Level2Port,
+		},
+		cli.IntFlag{
+			Name:        "derivative-port",
+			Value:       iqfeed.DefaultDerivativePort,
+			Usage:       "IQFeed derivative port used by bars-live",
+			EnvVar:      "IQFEED_DERIVATIVE_PORT",
+			Destination: &config.DerivativePort,
+		},
+		cli.StringFlag{
+			Name:        "record",
+			Value:       "",
+			Usage:       "record the raw IQFeed bytes of each symbol to `directory`",
+			Destination: &config.RecordDirectory,
+		},
+		cli.StringFlag{
+			Name:        "replay",
+			Value:       "",
+			Usage:       "replay the IQFeed bytes recorded in `directory` instead of connecting to IQFeed",
+			Destination: &config.ReplayDirectory,
+		},
+		cli.StringFlag{
+			Name:        "universe",
+			Value:       "",
+			Usage:       "look up the symbols instead of the symbols argument, for example \"market=NYSE,NASDAQ type=EQUITY\"",
+			Destination: &config.universe,
+		},
+		cli.StringFlag{
+			Name:        "report",
+			Value:       "",
+			Usage:       "write a JSON report of the download results to `file`",
+			Destination: &config.report,
 		},
 	}
 
@@ -132,6 +291,16 @@ func main() {
 			Usage:  "Download EOD bars",
 			Action: runCommand,
 		},
+		{
+			Name:   "weekly",
+			Usage:  "Download weekly bars",
+			Action: runCommand,
+		},
+		{
+			Name:   "monthly",
+			Usage:  "Download monthly bars",
+			Action: runCommand,
+		},
 		{
 			Name:   "minute",
 			Usage:  "Download minute bars",
@@ -141,6 +310,22 @@ func main() {
 			Name:   "tick",
 			Usage:  "Download tick data",
 			Action: runCommand,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "microseconds",
+					Usage:       "keep microsecond timestamps and add the aggressor and daycode columns",
+					Destination: &config.MicrosecondTicks,
+				},
+			},
+			Before: func(c *cli.Context) error {
+				if config.MicrosecondTicks {
+					log.Infof("Using newer protocol required for microsecond ticks, "+
+						"requiring at least IQFeed %s", iqfeed.MicrosecondProtocol)
+					config.Protocol = iqfeed.MicrosecondProtocol
+				}
+
+				return nil
+			},
 		},
 		{
 			Name:      "interval",
@@ -148,30 +333,163 @@ func main() {
 			Action:    runCommand,
 			ArgsUsage: "<length> <type>",
 			Before: func(c *cli.Context) error {
-				if len(c.Args()) < 3 {
-					return fmt.Errorf("incorrect number of interval parameters: %d", len(c.Args()))
-				}
-
-				config.intervalType = c.Args()[1]
-				intervalLength, err := strconv.Atoi(c.Args()[0])
-				config.intervalLength = intervalLength
-
-				if config.intervalLength <= 0 {
-					err = fmt.Errorf("incorrect interval length: %s", c.Args()[0])
-				} else {
-					err = mapIntervalType(config.intervalType, &config.intervalType)
-				}
+				err := parseIntervalArguments(c)
 
-				if !config.endTimestamp {
+				if err == nil && !config.EndTimestamp {
 					log.Infof("Using newer protocol required for bar start timestamps, "+
-						"requiring at least IQFeed %s", newProtocol)
-					config.protocol = newProtocol
-					config.useLabels = true
+						"requiring at least IQFeed %s", iqfeed.NewProtocol)
+					config.Protocol = iqfeed.NewProtocol
+					config.UseLabels = true
 				}
 
 				return err
 			},
 		},
+		{
+			Name:   "stream",
+			Usage:  "Stream realtime trades and quotes to daily files until stopped",
+			Action: runStream,
+		},
+		{
+			Name:      "bars-live",
+			Usage:     "Stream interval bars, backfilled and then live until stopped: <length> <seconds|volume|ticks>",
+			Action:    runStream,
+			ArgsUsage: "<length> <type>",
+			Before: func(c *cli.Context) error {
+				err := parseIntervalArguments(c)
+				config.Protocol = iqfeed.NewProtocol
+				return err
+			},
+		},
+		{
+			Name:   "depth",
+			Usage:  "Stream Level 2 market maker quotes to daily files until stopped",
+			Action: runStream,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "market-maker",
+					Usage: "only record quotes of the market maker, repeat for more market makers",
+				},
+				cli.DurationFlag{
+					Name:        "snapshot",
+					Usage:       "also write the full book to snapshot files at this interval",
+					Destination: &config.SnapshotInterval,
+				},
+			},
+			Before: func(c *cli.Context) error {
+				config.MarketMakers = c.StringSlice("market-maker")
+				return nil
+			},
+		},
+		{
+			Name:      "futures",
+			Usage:     "Download the contracts of a futures root and stitch them into a continuous series",
+			Action:    runFutures,
+			ArgsUsage: "<root>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "bars",
+					Value:       "eod",
+					Usage:       "contract bars: eod or minute",
+					Destination: &config.futuresBars,
+				},
+				cli.StringFlag{
+					Name:        "months",
+					Value:       iqfeed.FuturesMonths,
+					Usage:       "contract month codes, for example HMUZ for quarterly contracts",
+					Destination: &config.ContractMonths,
+				},
+				cli.StringFlag{
+					Name:        "roll",
+					Value:       iqfeed.RollVolume,
+					Usage:       "roll rule: volume or oi crossover, or days before expiry",
+					Destination: &config.Roll,
+				},
+				cli.IntFlag{
+					Name:        "roll-days",
+					Value:       5,
+					Usage:       "trading days before expiry of the days roll rule",
+					Destination: &config.RollDays,
+				},
+				cli.StringFlag{
+					Name:        "back-adjust",
+					Value:       iqfeed.RollAdjustNone,
+					Usage:       "price adjustment at rolls: none, difference or ratio",
+					Destination: &config.RollAdjustment,
+				},
+			},
+		},
+		{
+			Name:      "options",
+			Usage:     "Look up the option chain of an underlying, and optionally download the history of each option",
+			Action:    runOptions,
+			ArgsUsage: "<underlying>",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "futures",
+					Usage: "look up the options of a futures root instead of an equity",
+				},
+				cli.StringFlag{
+					Name:  "side",
+					Value: "both",
+					Usage: "calls, puts or both",
+				},
+				cli.StringFlag{
+					Name:  "expiry-from",
+					Usage: "first expiry date: yyyymmdd",
+				},
+				cli.StringFlag{
+					Name:  "expiry-to",
+					Usage: "last expiry date: yyyymmdd",
+				},
+				cli.Float64Flag{
+					Name:  "strike-min",
+					Usage: "lowest strike",
+				},
+				cli.Float64Flag{
+					Name:  "strike-max",
+					Usage: "highest strike",
+				},
+				cli.StringFlag{
+					Name:  "download",
+					Usage: "download eod or tick history of each option into the directory of the underlying",
+				},
+			},
+		},
+		{
+			Name:      "resample",
+			Usage:     "Resample downloaded tick files into bars: <size> <time|volume|tick|dollar|range>",
+			Action:    runResample,
+			ArgsUsage: "<size> <type>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "in",
+					Value:       "",
+					Usage:       "directory of the tick files",
+					Destination: &config.InDirectory,
+				},
+			},
+		},
+		{
+			Name:   "fundamentals",
+			Usage:  "Download a fundamental data snapshot with one row per symbol",
+			Action: runFundamentals,
+		},
+		{
+			Name:      "symbols",
+			Usage:     "Look up the symbols of a universe and write them to a symbols file or stdout",
+			Action:    runSymbols,
+			ArgsUsage: "<universe> [file]",
+		},
+	}
+
+	app.Before = func(c *cli.Context) error {
+		err := iqfeed.ValidateFormat(&config.Config)
+		if err != nil {
+			return err
+		}
+
+		return iqfeed.ValidateTimeFormat(&config.Config)
 	}
 
 	app.Action = showUsageWhenMissingCommand
@@ -183,22 +501,6 @@ func main() {
 	}
 }
 
-func mapIntervalType(argument string, intervalType *string) error {
-	arg := strings.ToUpper(argument)
-
-	if strings.HasPrefix(arg, "S") {
-		*intervalType = "S"
-	} else if strings.HasPrefix(arg, "V") {
-		*intervalType = "V"
-	} else if strings.HasPrefix(arg, "T") {
-		*intervalType = "T"
-	} else {
-		return fmt.Errorf("incorrect interval type: %s", argument)
-	}
-
-	return nil
-}
-
 func showUsageWhenMissingCommand(c *cli.Context) error {
 	return showUsageWithError(c, "Command argument is missing")
 }
@@ -210,23 +512,433 @@ func showUsageWithError(c *cli.Context, message string) error {
 }
 
 func runCommand(c *cli.Context) error {
-	if c.NArg() == 0 {
+	if c.NArg() == 0 && config.universe == "" {
 		return showUsageWithError(c, "Comma separated symbols or symbols filename argument missing")
 	}
 
-	config.command = c.Command.Name
-	createOutDirectory(config.outDirectory)
-	symbols, err := getSymbols(c.Args()[len(c.Args())-1])
+	config.Command = c.Command.Name
+	err := iqfeed.ValidateChunk(&config.Config)
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	err = iqfeed.ValidateAdjust(&config.Config)
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	err = iqfeed.ValidateSession(&config.Config)
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	err = iqfeed.ValidateRecent(&config.Config)
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	err = iqfeed.ValidateUpdate(&config.Config)
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	if config.RecordDirectory != "" && config.ReplayDirectory != "" {
+		return showUsageWithError(c, "Record and replay can not be combined")
+	}
+
+	createOutDirectory(config.OutDirectory)
+	symbols, err := resolveSymbols(c)
+	if err != nil {
+		return err
+	}
+
+	return downloadSymbols(symbols)
+}
+
+// downloadSymbols downloads the symbols with the command of the config and reports the results
+func downloadSymbols(symbols []string) error {
+	summary, err := runDownloads(symbols, getDownloadCommandFunction())
 	if err != nil {
 		return err
 	}
 
-	wg := start(symbols, &config)
+	return summaryError(summary, len(symbols))
+}
+
+// runDownloads downloads the symbols with the download function, logs the summary and writes the report
+func runDownloads(symbols []string, downloadFunc iqfeed.DownloadFunc) (*report, error) {
+	if config.RecordDirectory != "" {
+		createOutDirectory(config.RecordDirectory)
+	}
+
+	started := time.Now()
+	wg, results := start(appContext, symbols, &config, downloadFunc)
 
 	wg.Wait()
+	close(results)
+
+	summary := createReport(config.Command, started, results)
+	summary.log()
+
+	if config.report != "" {
+		err := summary.write(config.report)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return summary, nil
+}
+
+// summaryError returns the exit error of an interrupted run or of failed downloads
+func summaryError(summary *report, symbols int) error {
+	if appContext.Err() != nil {
+		completed := summary.Symbols - summary.Cancelled
+		return cli.NewExitError(fmt.Sprintf("ERROR: interrupted after %d of %d symbols", completed, symbols), 1)
+	}
+
+	if summary.Failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %d of %d downloads failed", summary.Failed, summary.Symbols), 1)
+	}
+
+	return nil
+}
+
+// parseIntervalArguments parses the interval length and type arguments of the interval commands
+func parseIntervalArguments(c *cli.Context) error {
+	if len(c.Args()) < 3 && !(config.universe != "" && len(c.Args()) == 2) {
+		return fmt.Errorf("incorrect number of interval parameters: %d", len(c.Args()))
+	}
+
+	config.IntervalType = c.Args()[1]
+	intervalLength, err := strconv.Atoi(c.Args()[0])
+	config.IntervalLength = intervalLength
+
+	if config.IntervalLength <= 0 {
+		return fmt.Errorf("incorrect interval length: %s", c.Args()[0])
+	}
+
+	intervalType, err := iqfeed.ParseIntervalType(config.IntervalType)
+	config.IntervalType = string(intervalType)
+
+	return err
+}
+
+func runStream(c *cli.Context) error {
+	if c.NArg() == 0 && config.universe == "" {
+		return showUsageWithError(c, "Comma separated symbols or symbols filename argument missing")
+	}
+
+	if config.Format == iqfeed.ParquetFormat {
+		return showUsageWithError(c, "Streaming to parquet files is not supported")
+	}
+
+	if config.Session != "" {
+		return showUsageWithError(c, "Sessions are not supported when streaming")
+	}
+
+	if config.Days > 0 || config.MaxPoints > 0 {
+		return showUsageWithError(c, "Days and datapoints are not supported when streaming")
+	}
+
+	if config.TimeFormat != iqfeed.TimeFormatIQFeed {
+		return showUsageWithError(c, "Time formats are not supported when streaming")
+	}
+
+	config.Command = c.Command.Name
+	createOutDirectory(config.OutDirectory)
+	symbols, err := resolveSymbols(c)
+	if err != nil {
+		return err
+	}
+
+	switch config.Command {
+	case "bars-live":
+		err = iqfeed.StreamBars(appContext, symbols, &config.Config)
+	case "depth":
+		err = iqfeed.StreamDepth(appContext, symbols, &config.Config)
+	default:
+		err = iqfeed.Stream(appContext, symbols, &config.Config)
+	}
+
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %s", err), 1)
+	}
+
+	return nil
+}
+
+func runResample(c *cli.Context) error {
+	if len(c.Args()) < 3 && !(config.universe != "" && len(c.Args()) == 2) {
+		return showUsageWithError(c, fmt.Sprintf("incorrect number of resample parameters: %d", len(c.Args())))
+	}
+
+	config.Command = c.Command.Name
+	config.BarType = c.Args()[1]
+	barSize, err := strconv.ParseFloat(c.Args()[0], 64)
+	if err != nil {
+		return showUsageWithError(c, fmt.Sprintf("incorrect bar size: %s", c.Args()[0]))
+	}
+
+	config.BarSize = barSize
+	err = iqfeed.ValidateResample(&config.Config)
+	if err == nil {
+		err = iqfeed.ValidateSession(&config.Config)
+	}
+	if err == nil {
+		err = iqfeed.ValidateRecent(&config.Config)
+	}
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	createOutDirectory(config.OutDirectory)
+	symbols, err := resolveSymbols(c)
+	if err != nil {
+		return err
+	}
+
+	return downloadSymbols(symbols)
+}
+
+func runFutures(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return showUsageWithError(c, "Futures root argument missing")
+	}
+
+	if config.Format == iqfeed.ParquetFormat {
+		return showUsageWithError(c, "Continuous futures are not supported in parquet files")
+	}
+
+	if config.Adjust != "" {
+		return showUsageWithError(c, "Split adjustment is not supported for futures")
+	}
+
+	if config.Days > 0 || config.MaxPoints > 0 {
+		return showUsageWithError(c, "Continuous futures require a date range instead of days or datapoints")
+	}
+
+	if config.RecordDirectory != "" && config.ReplayDirectory != "" {
+		return showUsageWithError(c, "Record and replay can not be combined")
+	}
+
+	config.Command = config.futuresBars
+	err := iqfeed.ValidateFutures(&config.Config)
+	if err == nil {
+		err = iqfeed.ValidateChunk(&config.Config)
+	}
+	if err == nil {
+		err = iqfeed.ValidateSession(&config.Config)
+	}
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	root := c.Args()[0]
+	contracts, err := iqfeed.FuturesContracts(root, &config.Config, time.Now())
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	log.WithFields(log.Fields{"root": strings.ToUpper(root), "contracts": len(contracts)}).Info("Expanded contracts")
+	createOutDirectory(config.OutDirectory)
+
+	// Contracts that do not exist are no data, and failed contracts are reported after building from the others
+	summary, err := runDownloads(contracts, iqfeed.DownloadContract(getDownloadCommandFunction()))
+	if err != nil {
+		return err
+	}
+
+	if appContext.Err() != nil {
+		return summaryError(summary, len(contracts))
+	}
+
+	err = iqfeed.BuildContinuous(root, contracts, &config.Config)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %s", err), 1)
+	}
+
+	return summaryError(summary, len(contracts))
+}
+
+func runOptions(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return showUsageWithError(c, "Underlying argument missing")
+	}
+
+	filter, err := parseChainFilter(c)
+	if err != nil {
+		return showUsageWithError(c, err.Error())
+	}
+
+	config.Command = strings.ToLower(c.String("download"))
+
+	switch config.Command {
+	case "":
+	case "eod", "tick":
+		err = iqfeed.ValidateChunk(&config.Config)
+		if err == nil {
+			err = iqfeed.ValidateAdjust(&config.Config)
+		}
+		if err == nil {
+			err = iqfeed.ValidateSession(&config.Config)
+		}
+		if err == nil {
+			err = iqfeed.ValidateRecent(&config.Config)
+		}
+		if err != nil {
+			return showUsageWithError(c, err.Error())
+		}
+	default:
+		return showUsageWithError(c, fmt.Sprintf("Unsupported option download: %s", config.Command))
+	}
+
+	if config.RecordDirectory != "" && config.ReplayDirectory != "" {
+		return showUsageWithError(c, "Record and replay can not be combined")
+	}
+
+	underlying := c.Args()[0]
+	client := &iqfeed.Client{Host: config.Host, LookupPort: config.LookupPort}
+	var contracts []iqfeed.OptionContract
+
+	if c.Bool("futures") {
+		contracts, err = client.FutureOptionChain(appContext, underlying, filter)
+	} else {
+		contracts, err = client.EquityOptionChain(appContext, underlying, filter)
+	}
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %s", err), 1)
+	}
+
+	directory, err := iqfeed.WriteOptionChain(underlying, contracts, &config.Config)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %s", err), 1)
+	}
+
+	log.WithFields(log.Fields{"underlying": strings.ToUpper(underlying), "options": len(contracts), "directory": directory}).Info("Wrote option chain")
+
+	if config.Command == "" {
+		return nil
+	}
+
+	symbols := make([]string, 0, len(contracts))
+
+	for _, contract := range contracts {
+		symbols = append(symbols, contract.Symbol)
+	}
+
+	config.OutDirectory = directory
+	return downloadSymbols(symbols)
+}
+
+// parseChainFilter parses the side, expiry and strike options of the options command
+func parseChainFilter(c *cli.Context) (iqfeed.ChainFilter, error) {
+	filter := iqfeed.ChainFilter{StrikeMin: c.Float64("strike-min"), StrikeMax: c.Float64("strike-max")}
+
+	switch strings.ToLower(c.String("side")) {
+	case "calls", "c":
+		filter.Side = iqfeed.OptionCalls
+	case "puts", "p":
+		filter.Side = iqfeed.OptionPuts
+	case "both", "":
+		filter.Side = iqfeed.OptionBoth
+	default:
+		return filter, fmt.Errorf("unsupported option side: %s", c.String("side"))
+	}
+
+	for _, expiry := range []struct {
+		value  string
+		target *time.Time
+	}{{c.String("expiry-from"), &filter.ExpiryFrom}, {c.String("expiry-to"), &filter.ExpiryTo}} {
+		if expiry.value == "" {
+			continue
+		}
+
+		date, err := time.Parse("20060102", expiry.value)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect expiry date: %s", expiry.value)
+		}
+
+		*expiry.target = date
+	}
+
+	return filter, nil
+}
+
+func runFundamentals(c *cli.Context) error {
+	if c.NArg() == 0 && config.universe == "" {
+		return showUsageWithError(c, "Comma separated symbols or symbols filename argument missing")
+	}
+
+	if config.Format == iqfeed.ParquetFormat {
+		return showUsageWithError(c, "Fundamentals are not supported in parquet files")
+	}
+
+	config.Command = c.Command.Name
+	createOutDirectory(config.OutDirectory)
+	symbols, err := resolveSymbols(c)
+	if err != nil {
+		return err
+	}
+
+	err = iqfeed.DownloadFundamentals(appContext, symbols, &config.Config)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %s", err), 1)
+	}
+
+	return nil
+}
+
+func runSymbols(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return showUsageWithError(c, "Universe argument missing")
+	}
+
+	symbols, err := lookupUniverse(c.Args()[0])
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: %s", err), 1)
+	}
+
+	content := strings.Join(symbols, "\n") + "\n"
+
+	if c.NArg() < 2 {
+		fmt.Print(content)
+		return nil
+	}
+
+	err = ioutil.WriteFile(c.Args()[1], []byte(content), 0644)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("ERROR: could not write symbols file: %s", err), 1)
+	}
+
+	log.WithFields(log.Fields{"symbols": len(symbols), "file": c.Args()[1]}).Info("Wrote symbols")
 	return nil
 }
 
+// cancelOnSignal returns a context that is cancelled on the first SIGINT or SIGTERM,
+// a second signal terminates the process immediately
+func cancelOnSignal() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			log.WithField("signal", sig).Warn("Stopping, aborting downloads in progress")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
 func setupLogging(detailedLogging bool) {
 	if detailedLogging {
 		log.SetHandler(text.New(os.Stderr))
@@ -270,7 +982,39 @@ func getSymbols(symbolsOrSymbolsFile string) ([]string, error) {
 	return sanitizedSymbols, nil
 }
 
-func start(symbols []string, config *Config) *sync.WaitGroup {
+// resolveSymbols returns the symbols of the universe option, or else of the last argument
+func resolveSymbols(c *cli.Context) ([]string, error) {
+	if config.universe != "" {
+		return lookupUniverse(config.universe)
+	}
+
+	return getSymbols(c.Args()[len(c.Args())-1])
+}
+
+// lookupUniverse looks up the symbols of a universe on the IQFeed lookup port
+func lookupUniverse(spec string) ([]string, error) {
+	universe, err := iqfeed.ParseUniverse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &iqfeed.Client{Host: config.Host, LookupPort: config.LookupPort}
+	infos, err := client.Symbols(appContext, universe)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]string, 0, len(infos))
+
+	for _, info := range infos {
+		symbols = append(symbols, info.Symbol)
+	}
+
+	log.WithFields(log.Fields{"symbols": len(symbols), "universe": spec}).Info("Looked up symbols")
+	return symbols, nil
+}
+
+func start(ctx context.Context, symbols []string, config *Config, downloadFunc iqfeed.DownloadFunc) (*sync.WaitGroup, chan iqfeed.DownloadResult) {
 	symbolsQueue := make(chan string, len(symbols))
 
 	for _, symbol := range symbols {
@@ -279,40 +1023,54 @@ func start(symbols []string, config *Config) *sync.WaitGroup {
 
 	close(symbolsQueue)
 
-	downloadFunc := getDownloadCommandFunction()
+	results := make(chan iqfeed.DownloadResult, len(symbols))
 	wg := sync.WaitGroup{}
 
 	log.Debug("Starting downloaders")
 
 	for i := 0; i < config.parallelism; i++ {
-		go downloader(symbolsQueue, &wg, config, downloadFunc)
+		go downloader(ctx, symbolsQueue, results, &wg, &config.Config, downloadFunc)
 		wg.Add(1)
 	}
 
-	return &wg
+	return &wg, results
 }
 
-func getDownloadCommandFunction() DownloadFunc {
-	switch strings.ToLower(config.command) {
+func getDownloadCommandFunction() iqfeed.DownloadFunc {
+	switch strings.ToLower(config.Command) {
 	case "eod":
-		return DownloadEod
+		return iqfeed.DownloadEod
+	case "weekly":
+		return iqfeed.DownloadWeekly
+	case "monthly":
+		return iqfeed.DownloadMonthly
 	case "minute":
-		return DownloadMinute
+		return iqfeed.DownloadMinute
 	case "tick":
-		return DownloadTicks
+		return iqfeed.DownloadTicks
 	case "interval":
-		return DownloadInterval
+		return iqfeed.DownloadInterval
+	case "resample":
+		return iqfeed.ResampleTicks
 	}
 
-	log.Fatalf("Unsupported download function: %s", config.command)
+	log.Fatalf("Unsupported download function: %s", config.Command)
 	return nil
 }
 
-func downloader(symbolsQueue <-chan string, wg *sync.WaitGroup, config *Config, downloadFunc DownloadFunc) {
+func downloader(ctx context.Context, symbolsQueue <-chan string, results chan<- iqfeed.DownloadResult, wg *sync.WaitGroup, config *iqfeed.Config, downloadFunc iqfeed.DownloadFunc) {
 	log.Debug("Downloader started")
 
+	connection := &iqfeed.Conn{}
+	defer connection.Close()
+
+	// Stop taking new symbols when cancelled
 	for symbol := range symbolsQueue {
-		downloadFunc(symbol, config)
+		if ctx.Err() != nil {
+			break
+		}
+
+		results <- iqfeed.DownloadWithRetry(ctx, symbol, connection, config, downloadFunc)
 	}
 
 	wg.Done()
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nhedlund/qdownload/iqfeed"
+)
+
+// report summarizes the download results of a run
+type report struct {
+	Command       string         `json:"command"`
+	Started       time.Time      `json:"started"`
+	DurationMs    int64          `json:"duration_ms"`
+	Symbols       int            `json:"symbols"`
+	Succeeded     int            `json:"succeeded"`
+	Skipped       int            `json:"skipped"`
+	NoData        int            `json:"no_data"`
+	Failed        int            `json:"failed"`
+	Cancelled     int            `json:"cancelled"`
+	Rows          int            `json:"rows"`
+	Bytes         int64          `json:"bytes"`
+	FailedSymbols []string       `json:"failed_symbols"`
+	Results       []reportResult `json:"results"`
+}
+
+type reportResult struct {
+	Symbol     string                `json:"symbol"`
+	Status     iqfeed.DownloadStatus `json:"status"`
+	Rows       int                   `json:"rows"`
+	Bytes      int64                 `json:"bytes"`
+	DurationMs int64                 `json:"duration_ms"`
+	Error      string                `json:"error,omitempty"`
+}
+
+func createReport(command string, started time.Time, results <-chan iqfeed.DownloadResult) *report {
+	r := &report{
+		Command:       command,
+		Started:       started,
+		FailedSymbols: []string{},
+		Results:       []reportResult{},
+	}
+
+	for result := range results {
+		entry := reportResult{
+			Symbol:     result.Symbol,
+			Status:     result.Status,
+			Rows:       result.Rows,
+			Bytes:      result.Bytes,
+			DurationMs: result.Duration.Milliseconds(),
+		}
+
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+
+		switch result.Status {
+		case iqfeed.StatusSuccess:
+			r.Succeeded++
+		case iqfeed.StatusSkipped:
+			r.Skipped++
+		case iqfeed.StatusNoData:
+			r.NoData++
+		case iqfeed.StatusFailed:
+			r.Failed++
+			r.FailedSymbols = append(r.FailedSymbols, result.Symbol)
+		case iqfeed.StatusCancelled:
+			r.Cancelled++
+		}
+
+		r.Symbols++
+		r.Rows += result.Rows
+		r.Bytes += result.Bytes
+		r.Results = append(r.Results, entry)
+	}
+
+	sort.Strings(r.FailedSymbols)
+	sort.Slice(r.Results, func(i, j int) bool {
+		return r.Results[i].Symbol < r.Results[j].Symbol
+	})
+
+	r.DurationMs = time.Since(started).Milliseconds()
+
+	return r
+}
+
+func (r *report) log() {
+	for _, result := range r.Results {
+		if result.Status == iqfeed.StatusFailed {
+			log.WithFields(log.Fields{
+				"symbol": result.Symbol,
+				"error":  result.Error,
+			}).Error("Failed")
+		}
+	}
+
+	ctx := log.WithFields(log.Fields{
+		"symbols":   r.Symbols,
+		"succeeded": r.Succeeded,
+		"skipped":   r.Skipped,
+		"nodata":    r.NoData,
+		"failed":    r.Failed,
+		"cancelled": r.Cancelled,
+		"rows":      r.Rows,
+		"bytes":     r.Bytes,
+		"duration":  fmt.Sprintf("%dms", r.DurationMs),
+	})
+
+	if r.Failed > 0 || r.Cancelled > 0 {
+		ctx.Error("Summary")
+	} else {
+		ctx.Info("Summary")
+	}
+}
+
+func (r *report) write(path string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nhedlund/qdownload/iqfeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateReport(t *testing.T) {
+	t.Run("aggregates results", func(t *testing.T) {
+		results := make(chan iqfeed.DownloadResult, 4)
+		results <- iqfeed.DownloadResult{Symbol: "SPY", Status: iqfeed.StatusSuccess, Rows: 10, Bytes: 500, Duration: time.Second}
+		results <- iqfeed.DownloadResult{Symbol: "QQQ", Status: iqfeed.StatusSkipped}
+		results <- iqfeed.DownloadResult{Symbol: "XYZ", Status: iqfeed.StatusNoData}
+		results <- iqfeed.DownloadResult{Symbol: "AAPL", Status: iqfeed.StatusFailed, Err: errors.New("connection closed by IQFeed")}
+		close(results)
+
+		r := createReport("eod", time.Now(), results)
+
+		assert.Equal(t, 4, r.Symbols)
+		assert.Equal(t, 1, r.Succeeded)
+		assert.Equal(t, 1, r.Skipped)
+		assert.Equal(t, 1, r.NoData)
+		assert.Equal(t, 1, r.Failed)
+		assert.Equal(t, 10, r.Rows)
+		assert.Equal(t, int64(500), r.Bytes)
+		assert.Equal(t, []string{"AAPL"}, r.FailedSymbols)
+		assert.Equal(t, "AAPL", r.Results[0].Symbol)
+		assert.Equal(t, "connection closed by IQFeed", r.Results[0].Error)
+		assert.Equal(t, int64(1000), r.Results[2].DurationMs)
+	})
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Run("json report", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		results := make(chan iqfeed.DownloadResult, 1)
+		results <- iqfeed.DownloadResult{Symbol: "SPY", Status: iqfeed.StatusFailed, Err: errors.New("iqfeed error: Invalid symbol.")}
+		close(results)
+
+		err := createReport("minute", time.Now(), results).write(path)
+		content, _ := ioutil.ReadFile(path)
+		var written map[string]interface{}
+		_ = json.Unmarshal(content, &written)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "minute", written["command"])
+		assert.Equal(t, float64(1), written["failed"])
+		assert.Equal(t, []interface{}{"SPY"}, written["failed_symbols"])
+	})
+}